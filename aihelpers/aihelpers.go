@@ -5,6 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
 
 	openai "github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
@@ -14,6 +18,23 @@ type AIClient struct {
 	APIKey string
 	Model  string
 	Client *openai.Client
+	// Limiter, if set, is waited on before every request
+	Limiter *RateLimiter
+	// Redactor, if set, removes secrets from every prompt before it is sent
+	Redactor *Redactor
+	// Audit, if set, records every request and its response
+	Audit *AuditLog
+	// Prices override the list prices in ModelPrices for the models they name
+	Prices Prices
+	// Budget stops new requests once it is spent
+	Budget Budget
+
+	meter usageMeter
+}
+
+// Usage returns the tokens used by the client's requests so far, per model.
+func (client *AIClient) Usage() []Usage {
+	return client.meter.usage()
 }
 
 // NewOpenAIClient initializes a new OpenAI client with the API key and model.
@@ -33,9 +54,83 @@ func (client *AIClient) SetModel(model string) {
 
 // PromptRequest represents the parameters for a prompt request.
 type PromptRequest struct {
+	// System holds the instructions, sent in the system role so the prompt cannot override them
+	System      string
 	Prompt      string
 	MaxTokens   int
 	Temperature float64
+	// Model, if set, is used instead of the client's model
+	Model string
+}
+
+// model is the model req is sent to.
+func (client *AIClient) model(req PromptRequest) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	return client.Model
+}
+
+func (client *AIClient) wait(ctx context.Context) error {
+	if client.Limiter == nil {
+		return nil
+	}
+	if err := client.Limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("waiting for rate limit: %w", err)
+	}
+	return nil
+}
+
+// redact is the single place prompts pass through before leaving the machine. The instructions are redacted as well
+// as the prompt, they can hold repository text such as templates and guidelines. It returns the instructions and the
+// prompt to send, and the number of secrets replaced.
+func (client *AIClient) redact(ctx context.Context, req PromptRequest) (string, string, int) {
+	if client.Redactor == nil {
+		return req.System, req.Prompt, 0
+	}
+	system, counts := client.Redactor.Redact(req.System)
+	prompt, promptCounts := client.Redactor.Redact(req.Prompt)
+	for kind, n := range promptCounts {
+		counts[kind] += n
+	}
+	total := 0
+	if len(counts) > 0 {
+		var attrs []any
+		for _, kind := range slices.Sorted(maps.Keys(counts)) {
+			attrs = append(attrs, kind, counts[kind])
+			total += counts[kind]
+		}
+		slog.InfoContext(ctx, "Redacted secrets from prompt", attrs...)
+	}
+	return system, prompt, total
+}
+
+func messages(system, prompt string) []openai.ChatCompletionMessageParamUnion {
+	var messages []openai.ChatCompletionMessageParamUnion
+	if system != "" {
+		messages = append(messages, openai.SystemMessage(system))
+	}
+	return append(messages, openai.UserMessage(prompt))
+}
+
+// audit records a finished request, if there is an audit log. Failing to record is logged, not returned,
+// so the audit log cannot fail a review.
+func (client *AIClient) audit(ctx context.Context, record AuditRecord, start time.Time, err error) {
+	if client.Audit == nil {
+		return
+	}
+	record.Time = start.UTC()
+	record.Command = auditValue(ctx, auditCommandKey)
+	record.Target = auditValue(ctx, auditTargetKey)
+	record.LatencyMS = time.Since(start).Milliseconds()
+	record.Outcome = "ok"
+	if err != nil {
+		record.Outcome = "error"
+		record.Error = err.Error()
+	}
+	if err := client.Audit.Write(record); err != nil {
+		slog.WarnContext(ctx, "Could not write the audit log", "path", client.Audit.Path(), "err", err)
+	}
 }
 
 func (client *AIClient) Prompt(ctx context.Context, req PromptRequest) (string, *openai.ChatCompletion, error) {
@@ -43,27 +138,48 @@ func (client *AIClient) Prompt(ctx context.Context, req PromptRequest) (string,
 		return "", nil, errors.New("API key is not set")
 	}
 
-	if client.Model == "" {
+	model := client.model(req)
+	if model == "" {
 		return "", nil, errors.New("model is not set")
 	}
 
+	if err := client.wait(ctx); err != nil {
+		return "", nil, err
+	}
+
+	// Checked after waiting, requests queued by the rate limiter must not start once the budget is spent
+	if err := client.CheckBudget(); err != nil {
+		return "", nil, err
+	}
+
 	//TODO: Use req to tailor the request
 
+	system, prompt, redactions := client.redact(ctx, req)
+	record := AuditRecord{Model: model, PromptHash: promptHash(system, prompt), Redactions: redactions}
+	start := time.Now()
 	chatCompletion, err := client.Client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
-			openai.UserMessage(req.Prompt),
-		}),
-		Model: openai.F(client.Model),
+		Messages: openai.F(messages(system, prompt)),
+		Model:    openai.F(model),
 	})
 	if err != nil {
 		// wrap the error with additional context
-		return "", nil, fmt.Errorf("failed to create chat completion: %w", err)
+		err = fmt.Errorf("failed to create chat completion: %w", err)
+		client.audit(ctx, record, start, err)
+		return "", nil, err
 	}
 
+	client.meter.add(model, chatCompletion.Usage.PromptTokens, chatCompletion.Usage.CompletionTokens)
+	record.PromptTokens = chatCompletion.Usage.PromptTokens
+	record.CompletionTokens = chatCompletion.Usage.CompletionTokens
+
 	if len(chatCompletion.Choices) == 0 {
-		return "", nil, errors.New("no response choices from OpenAI")
+		err = errors.New("no response choices from OpenAI")
+		client.audit(ctx, record, start, err)
+		return "", nil, err
 	}
 
+	record.Response = chatCompletion.Choices[0].Message.Content
+	client.audit(ctx, record, start, nil)
 	return chatCompletion.Choices[0].Message.Content, chatCompletion, nil
 }
 
@@ -72,31 +188,59 @@ func (client *AIClient) PromptStream(ctx context.Context, req PromptRequest) (st
 		return "", errors.New("API key is not set")
 	}
 
-	if client.Model == "" {
+	model := client.model(req)
+	if model == "" {
 		return "", errors.New("model is not set")
 	}
 
+	if err := client.wait(ctx); err != nil {
+		return "", err
+	}
+
+	// Checked after waiting, requests queued by the rate limiter must not start once the budget is spent
+	if err := client.CheckBudget(); err != nil {
+		return "", err
+	}
+
 	// Use req to tailor the request
+	system, prompt, redactions := client.redact(ctx, req)
+	record := AuditRecord{Model: model, PromptHash: promptHash(system, prompt), Redactions: redactions}
+	start := time.Now()
 	stream := client.Client.Chat.Completions.NewStreaming(ctx, openai.ChatCompletionNewParams{
-		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
-			openai.UserMessage(req.Prompt),
-		}),
-		Model: openai.F(client.Model),
+		Messages: openai.F(messages(system, prompt)),
+		Model:    openai.F(model),
+		// The usage is only sent in a final chunk when asked for, it is needed for the budget
+		StreamOptions: openai.F(openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.F(true)}),
 	})
 
 	var responseContent string
+	var usage openai.CompletionUsage
 	for stream.Next() {
-		chatCompletion := stream.Current()
-		responseContent += chatCompletion.Choices[0].Delta.Content
+		chunk := stream.Current()
+		if chunk.Usage.TotalTokens > 0 {
+			usage = chunk.Usage
+		}
+		if len(chunk.Choices) > 0 {
+			responseContent += chunk.Choices[0].Delta.Content
+		}
 	}
+	client.meter.add(model, usage.PromptTokens, usage.CompletionTokens)
+	record.PromptTokens = usage.PromptTokens
+	record.CompletionTokens = usage.CompletionTokens
+	record.Response = responseContent
 
 	if stream.Err() != nil && !errors.Is(stream.Err(), io.EOF) {
-		return "", fmt.Errorf("error receiving stream response: %w", stream.Err())
+		err := fmt.Errorf("error receiving stream response: %w", stream.Err())
+		client.audit(ctx, record, start, err)
+		return "", err
 	}
 
 	if responseContent == "" {
-		return "", errors.New("no response content from OpenAI")
+		err := errors.New("no response content from OpenAI")
+		client.audit(ctx, record, start, err)
+		return "", err
 	}
 
+	client.audit(ctx, record, start, nil)
 	return responseContent, nil
 }
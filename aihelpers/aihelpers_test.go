@@ -2,6 +2,7 @@ package aihelpers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -30,6 +31,16 @@ func TestAIClient_SetModel(t *testing.T) {
 	}
 }
 
+func TestAIClient_RequestModel(t *testing.T) {
+	client := NewOpenAIClient("test_api_key", "test_model")
+	if got := client.model(PromptRequest{}); got != "test_model" {
+		t.Errorf("Expected the client's model, but got %s", got)
+	}
+	if got := client.model(PromptRequest{Model: "o3"}); got != "o3" {
+		t.Errorf("Expected the request's model, but got %s", got)
+	}
+}
+
 func TestAIClient_Prompt(t *testing.T) {
 	// Create a mock server
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -77,6 +88,10 @@ func TestAIClient_Prompt(t *testing.T) {
 	if content != "Hello, how can I help you?" {
 		t.Errorf("Expected content 'Hello, how can I help you?', but got '%s'", content)
 	}
+	usage := client.Usage()
+	if len(usage) != 1 || usage[0].Model != "test_model" || usage[0].Requests != 1 || usage[0].PromptTokens != 9 || usage[0].CompletionTokens != 12 {
+		t.Errorf("Expected the usage of one request to be recorded, but got %+v", usage)
+	}
 
 	// Test case 2: No API key
 	client.APIKey = ""
@@ -106,6 +121,7 @@ func TestAIClient_PromptStream(t *testing.T) {
 			`data: {"id":"chatcmpl-123","object":"chat.completion.chunk","created":1677652288,"model":"gpt-3.5-turbo-0613","choices":[{"index":0,"delta":{"content":", "},"finish_reason":null}]}`,
 			`data: {"id":"chatcmpl-123","object":"chat.completion.chunk","created":1677652288,"model":"gpt-3.5-turbo-0613","choices":[{"index":0,"delta":{"content":"how can I help you?"},"finish_reason":null}]}`,
 			`data: {"id":"chatcmpl-123","object":"chat.completion.chunk","created":1677652288,"model":"gpt-3.5-turbo-0613","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			`data: {"id":"chatcmpl-123","object":"chat.completion.chunk","created":1677652288,"model":"gpt-3.5-turbo-0613","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":12,"total_tokens":21}}`,
 			`data: [DONE]`,
 		}
 		for _, d := range data {
@@ -133,4 +149,14 @@ func TestAIClient_PromptStream(t *testing.T) {
 	if content != "Hello, how can I help you?" {
 		t.Errorf("Expected content 'Hello, how can I help you?', but got '%s'", content)
 	}
+	usage := client.Usage()
+	if len(usage) != 1 || usage[0].Requests != 1 || usage[0].PromptTokens != 9 || usage[0].CompletionTokens != 12 {
+		t.Errorf("Expected the usage of the streamed request to be recorded, but got %+v", usage)
+	}
+
+	// Requests do not start once the budget is spent
+	client.Budget = Budget{MaxTokens: 10}
+	if _, err := client.PromptStream(context.Background(), req); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected the budget to be exceeded, but got %v", err)
+	}
 }
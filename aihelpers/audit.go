@@ -0,0 +1,155 @@
+package aihelpers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AuditRecord is one line of the audit log, written for every request whether it succeeded or not.
+type AuditRecord struct {
+	Time     time.Time `json:"time"`
+	Command  string    `json:"command,omitempty"`
+	Target   string    `json:"target,omitempty"`
+	Provider string    `json:"provider,omitempty"`
+	Model    string    `json:"model"`
+	// PromptHash is the SHA-256 of the instructions and prompt as sent, after redaction
+	PromptHash       string `json:"prompt_hash"`
+	Redactions       int    `json:"redactions"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	LatencyMS        int64  `json:"latency_ms"`
+	Response         string `json:"response,omitempty"`
+	// Outcome is "ok" or "error"
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// AuditLog appends records to a JSONL file, rotating it when it grows past a size.
+// It is safe for concurrent use.
+type AuditLog struct {
+	path     string
+	provider string
+	maxBytes int64
+	maxFiles int
+
+	mu sync.Mutex
+}
+
+// NewAuditLog writes to path, creating its directory. Once the file would grow past maxBytes it is renamed to
+// path.1, older files move up by one, and at most maxFiles rotated files are kept. maxBytes <= 0 disables rotation.
+func NewAuditLog(path, provider string, maxBytes int64, maxFiles int) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	return &AuditLog{path: path, provider: provider, maxBytes: maxBytes, maxFiles: maxFiles}, nil
+}
+
+// Path is the file records are currently written to.
+func (a *AuditLog) Path() string {
+	return a.path
+}
+
+// Write appends the record, filling in the provider.
+func (a *AuditLog) Write(record AuditRecord) error {
+	record.Provider = a.provider
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.rotate(int64(len(line))); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return f.Close()
+}
+
+// rotate moves the log aside if appending n bytes would take it past maxBytes.
+func (a *AuditLog) rotate(n int64) error {
+	if a.maxBytes <= 0 {
+		return nil
+	}
+	info, err := os.Stat(a.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	if info.Size() == 0 || info.Size()+n <= a.maxBytes {
+		return nil
+	}
+	if err := os.Remove(a.rotated(a.maxFiles)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove old audit log: %w", err)
+	}
+	for i := a.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(a.rotated(i), a.rotated(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	}
+	if a.maxFiles < 1 {
+		return os.Remove(a.path)
+	}
+	if err := os.Rename(a.path, a.rotated(1)); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	return nil
+}
+
+func (a *AuditLog) rotated(i int) string {
+	return fmt.Sprintf("%s.%d", a.path, i)
+}
+
+// promptHash identifies a prompt in the audit log without storing it.
+func promptHash(system, prompt string) string {
+	h := sha256.New()
+	h.Write([]byte(system))
+	h.Write([]byte{0})
+	h.Write([]byte(prompt))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type auditKey int
+
+const (
+	auditCommandKey auditKey = iota
+	auditTargetKey
+)
+
+// WithAuditCommand records the command requests made with ctx are for, e.g. "pr".
+func WithAuditCommand(ctx context.Context, command string) context.Context {
+	return context.WithValue(ctx, auditCommandKey, command)
+}
+
+// WithAuditTarget records what requests made with ctx are about, e.g. a directory or pull request.
+func WithAuditTarget(ctx context.Context, target string) context.Context {
+	return context.WithValue(ctx, auditTargetKey, target)
+}
+
+// AuditTarget returns what requests made with ctx are about, as recorded by WithAuditTarget.
+func AuditTarget(ctx context.Context) string {
+	return auditValue(ctx, auditTargetKey)
+}
+
+func auditValue(ctx context.Context, key auditKey) string {
+	v, _ := ctx.Value(key).(string)
+	return v
+}
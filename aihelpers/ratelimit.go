@@ -0,0 +1,48 @@
+package aihelpers
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out requests evenly to stay under a requests per minute limit.
+// One limiter is shared by everything prompting through the same client.
+type RateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRateLimiter allows reqPerMin requests per minute, or no limit if reqPerMin is not positive.
+func NewRateLimiter(reqPerMin int) *RateLimiter {
+	if reqPerMin <= 0 {
+		return &RateLimiter{}
+	}
+	return &RateLimiter{interval: time.Minute / time.Duration(reqPerMin)}
+}
+
+// Wait blocks until the next request may be sent, or the context is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
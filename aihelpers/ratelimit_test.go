@@ -0,0 +1,47 @@
+package aihelpers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Wait(t *testing.T) {
+	// 6000 requests per minute is one every 10ms
+	limiter := NewRateLimiter(6000)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Expected no error, but got: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected 4 requests to take at least 30ms, but took %v", elapsed)
+	}
+}
+
+func TestRateLimiter_WaitCancelled(t *testing.T) {
+	limiter := NewRateLimiter(1)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Expected the first request to pass, but got: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); err == nil {
+		t.Error("Expected an error when the context is done, but got nil")
+	}
+}
+
+func TestRateLimiter_Unlimited(t *testing.T) {
+	limiter := NewRateLimiter(0)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Expected no error, but got: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected no waiting without a limit, but took %v", elapsed)
+	}
+}
@@ -0,0 +1,147 @@
+package aihelpers
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// secretPattern finds one kind of secret. If the expression has a group named "secret", only that group is redacted.
+type secretPattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+// secretPatterns are the known token formats, checked before the entropy heuristic.
+var secretPatterns = []secretPattern{
+	{"private-key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY( BLOCK)?-----`)},
+	{"aws-access-key", regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-key", regexp.MustCompile(`(?i)aws.{0,20}?(?:secret|key).{0,20}?[=:]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})\b`)},
+	{"github-token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`)},
+	{"openai-key", regexp.MustCompile(`\bsk-(?:proj-|svcacct-|admin-)?[A-Za-z0-9_-]{20,}`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+}
+
+// entropyCandidate finds strings long enough to be a key or token.
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/_\-=]{24,}`)
+
+// minEntropy is the Shannon entropy in bits per character above which a candidate counts as random.
+// Hex strings such as commit hashes stay below it, their entropy is at most 4.
+const minEntropy = 4.2
+
+// Redactor replaces secrets in prompts with placeholders before they are sent.
+// The same secret always gets the same placeholder, so the model can still tell secrets apart.
+type Redactor struct {
+	patterns []secretPattern
+
+	mu           sync.Mutex
+	placeholders map[string]string
+	kinds        map[string]int
+}
+
+// NewRedactor detects the known token formats, high-entropy strings, and the custom regular expressions.
+func NewRedactor(custom []string) (*Redactor, error) {
+	patterns := slices.Clone(secretPatterns)
+	for _, expr := range custom {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", expr, err)
+		}
+		patterns = append(patterns, secretPattern{"custom", re})
+	}
+	return &Redactor{patterns: patterns, placeholders: map[string]string{}, kinds: map[string]int{}}, nil
+}
+
+// Redact returns text with the secrets replaced, and how many were replaced of each kind.
+func (r *Redactor) Redact(text string) (string, map[string]int) {
+	counts := map[string]int{}
+	for _, p := range r.patterns {
+		group := p.re.SubexpIndex("secret")
+		text = replaceAllSubmatch(p.re, text, func(m []int) (int, int) {
+			if group > 0 && m[2*group] >= 0 {
+				return m[2*group], m[2*group+1]
+			}
+			return m[0], m[1]
+		}, func(secret string) string {
+			counts[p.kind]++
+			return r.placeholder(p.kind, secret)
+		})
+	}
+	text = entropyCandidate.ReplaceAllStringFunc(text, func(s string) string {
+		if isPlaceholder(s) || !looksRandom(s) {
+			return s
+		}
+		counts["high-entropy"]++
+		return r.placeholder("high-entropy", s)
+	})
+	return text, counts
+}
+
+func (r *Redactor) placeholder(kind, secret string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.placeholders[secret]; ok {
+		return p
+	}
+	r.kinds[kind]++
+	p := fmt.Sprintf("[REDACTED-%s-%d]", strings.ToUpper(kind), r.kinds[kind])
+	r.placeholders[secret] = p
+	return p
+}
+
+func isPlaceholder(s string) bool {
+	return strings.HasPrefix(s, "REDACTED-")
+}
+
+// replaceAllSubmatch replaces the span of each match chosen by span with the result of repl.
+func replaceAllSubmatch(re *regexp.Regexp, text string, span func(m []int) (int, int), repl func(string) string) string {
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := span(m)
+		sb.WriteString(text[last:start])
+		sb.WriteString(repl(text[start:end]))
+		last = end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// looksRandom reports whether s mixes upper case letters, lower case letters and digits with high entropy,
+// which identifiers, words and hashes rarely do.
+func looksRandom(s string) bool {
+	var upper, lower, digit bool
+	for _, c := range s {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		}
+	}
+	return upper && lower && digit && shannonEntropy(s) >= minEntropy
+}
+
+func shannonEntropy(s string) float64 {
+	freq := map[rune]float64{}
+	for _, c := range s {
+		freq[c]++
+	}
+	n := float64(len(s))
+	entropy := 0.0
+	for _, f := range freq {
+		p := f / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
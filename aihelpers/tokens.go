@@ -0,0 +1,77 @@
+package aihelpers
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// messageOverhead is the number of tokens the chat format adds per message, and once to prime the reply.
+const messageOverhead = 3
+
+// Encodings of the OpenAI tokenizers.
+const (
+	encodingO200k  = tiktoken.MODEL_O200K_BASE
+	encodingCL100k = tiktoken.MODEL_CL100K_BASE
+)
+
+var (
+	tokenizersMu sync.Mutex
+	tokenizers   = map[string]*tiktoken.Tiktoken{}
+)
+
+// tokenizer returns the tokenizer of the encoding, loading its vocabulary on first use. The vocabularies are
+// embedded, so counting tokens never goes to the network.
+func tokenizer(encoding string) (*tiktoken.Tiktoken, error) {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	if t, ok := tokenizers[encoding]; ok {
+		return t, nil
+	}
+	tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+	t, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	tokenizers[encoding] = t
+	return t, nil
+}
+
+// modelEncoding returns the tokenizer encoding of model: o200k_base for GPT-4o and newer models, cl100k_base for
+// older and unknown ones.
+func modelEncoding(model string) string {
+	for _, prefix := range []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4"} {
+		if strings.HasPrefix(model, prefix) {
+			return encodingO200k
+		}
+	}
+	return encodingCL100k
+}
+
+// CountTokens counts the tokens text takes for model, with the model's tokenizer.
+func CountTokens(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	encoding := modelEncoding(model)
+	t, err := tokenizer(encoding)
+	if err != nil {
+		// Cannot happen with the embedded vocabularies, but a count is still better than none
+		slog.Warn("Could not load the tokenizer, estimating four bytes per token", "encoding", encoding, "err", err)
+		return (len(text) + 3) / 4
+	}
+	// Special tokens in the text are counted as the text they are, as the API does for message content
+	return len(t.EncodeOrdinary(text))
+}
+
+// RequestTokens counts the prompt tokens of a request to model, including the chat format's overhead.
+func RequestTokens(model string, req PromptRequest) int {
+	tokens := messageOverhead + CountTokens(model, req.Prompt) + messageOverhead
+	if req.System != "" {
+		tokens += CountTokens(model, req.System) + messageOverhead
+	}
+	return tokens
+}
@@ -0,0 +1,40 @@
+package aihelpers
+
+import (
+	"testing"
+)
+
+func TestCountTokens(t *testing.T) {
+	testCases := []struct {
+		model string
+		text  string
+		want  int
+	}{
+		{"gpt-4o", "", 0},
+		{"gpt-4o", "Hello world", 2},
+		{"gpt-4o", "The quick brown fox jumps over the lazy dog.", 10},
+		{"gpt-4o", "func main() {\n\tfmt.Println(\"hi\")\n}\n", 10},
+		// Special tokens in the text are counted as text
+		{"gpt-4o", "<|endoftext|>", 7},
+		// The encodings differ: o200k_base has "don't" as one token, cl100k_base splits it
+		{"o3-mini", "don't", 1},
+		{"gpt-4-turbo", "don't", 2},
+		{"unknown-model", "don't", 2},
+	}
+	for _, tc := range testCases {
+		if got := CountTokens(tc.model, tc.text); got != tc.want {
+			t.Errorf("Expected %q to count %d tokens for %s, but got %d", tc.text, tc.want, tc.model, got)
+		}
+	}
+}
+
+func TestRequestTokens(t *testing.T) {
+	withSystem := RequestTokens("gpt-4o", PromptRequest{System: "Review the change.", Prompt: "Hello world"})
+	withoutSystem := RequestTokens("gpt-4o", PromptRequest{Prompt: "Hello world"})
+	if withoutSystem != 2+2*messageOverhead {
+		t.Errorf("Expected the prompt and the message overhead, but got %d", withoutSystem)
+	}
+	if withSystem != withoutSystem+4+messageOverhead {
+		t.Errorf("Expected the system message to add its tokens and overhead, but got %d", withSystem)
+	}
+}
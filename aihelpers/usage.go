@@ -0,0 +1,165 @@
+package aihelpers
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Usage counts the requests and tokens sent to one model.
+type Usage struct {
+	Model            string
+	Requests         int
+	PromptTokens     int64
+	CompletionTokens int64
+}
+
+// Price is the cost of a model in USD per million tokens.
+type Price struct {
+	Input  float64 `mapstructure:"input"`
+	Output float64 `mapstructure:"output"`
+}
+
+// Prices maps model names to their price. Dated model versions use the price of their base model.
+type Prices map[string]Price
+
+// ModelPrices are the list prices of common models.
+var ModelPrices = Prices{
+	"gpt-4o":       {Input: 2.50, Output: 10.00},
+	"gpt-4o-mini":  {Input: 0.15, Output: 0.60},
+	"gpt-4.1":      {Input: 2.00, Output: 8.00},
+	"gpt-4.1-mini": {Input: 0.40, Output: 1.60},
+	"gpt-4.1-nano": {Input: 0.10, Output: 0.40},
+	"gpt-4-turbo":  {Input: 10.00, Output: 30.00},
+	"o3-mini":      {Input: 1.10, Output: 4.40},
+	"o4-mini":      {Input: 1.10, Output: 4.40},
+}
+
+// Of returns the price of the longest model name in p that model starts with.
+func (p Prices) Of(model string) (Price, bool) {
+	var best string
+	for name := range p {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return p[best], true
+}
+
+// With returns the prices overridden by, and extended with, overrides.
+func (p Prices) With(overrides Prices) Prices {
+	if len(overrides) == 0 {
+		return p
+	}
+	prices := maps.Clone(p)
+	maps.Copy(prices, overrides)
+	return prices
+}
+
+// PriceOf returns the list price of model from ModelPrices.
+func PriceOf(model string) (Price, bool) {
+	return ModelPrices.Of(model)
+}
+
+// Cost estimates the cost of the usage in USD at list prices, it is false if the model's price is unknown.
+func (u Usage) Cost() (float64, bool) {
+	return u.CostAt(ModelPrices)
+}
+
+// CostAt estimates the cost of the usage in USD at the given prices, it is false if the model's price is unknown.
+func (u Usage) CostAt(prices Prices) (float64, bool) {
+	p, ok := prices.Of(u.Model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(u.PromptTokens)*p.Input + float64(u.CompletionTokens)*p.Output) / 1e6, true
+}
+
+// ErrBudgetExceeded is returned for requests made after the client's budget ran out.
+var ErrBudgetExceeded = errors.New("AI budget exceeded")
+
+// Budget limits what a client may spend. Zero limits are unlimited.
+type Budget struct {
+	// MaxCost is the limit in USD, requests to models without a known price are not counted
+	MaxCost   float64
+	MaxTokens int64
+}
+
+// prices are the list prices, overridden by the client's own prices.
+func (client *AIClient) prices() Prices {
+	return ModelPrices.With(client.Prices)
+}
+
+// Cost estimates the cost of the usage in USD at the client's prices, it is false if the model's price is unknown.
+func (client *AIClient) Cost(u Usage) (float64, bool) {
+	return u.CostAt(client.prices())
+}
+
+// Spent returns the tokens used by the client so far, and their cost where the price is known.
+func (client *AIClient) Spent() (int64, float64) {
+	var tokens int64
+	var cost float64
+	prices := client.prices()
+	for _, u := range client.Usage() {
+		tokens += u.PromptTokens + u.CompletionTokens
+		if c, ok := u.CostAt(prices); ok {
+			cost += c
+		}
+	}
+	return tokens, cost
+}
+
+// CheckBudget returns an error wrapping ErrBudgetExceeded once the client has spent more than its budget.
+// A nil client, as used in dry-run mode, has spent nothing.
+func (client *AIClient) CheckBudget() error {
+	if client == nil {
+		return nil
+	}
+	tokens, cost := client.Spent()
+	if client.Budget.MaxTokens > 0 && tokens > client.Budget.MaxTokens {
+		return fmt.Errorf("%w: %d tokens used, the limit is %d", ErrBudgetExceeded, tokens, client.Budget.MaxTokens)
+	}
+	if client.Budget.MaxCost > 0 && cost > client.Budget.MaxCost {
+		return fmt.Errorf("%w: $%.4f spent, the limit is $%.4f", ErrBudgetExceeded, cost, client.Budget.MaxCost)
+	}
+	return nil
+}
+
+// usageMeter accumulates usage per model, it is safe for concurrent use.
+type usageMeter struct {
+	mu      sync.Mutex
+	byModel map[string]*Usage
+}
+
+func (m *usageMeter) add(model string, promptTokens, completionTokens int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.byModel == nil {
+		m.byModel = map[string]*Usage{}
+	}
+	u, ok := m.byModel[model]
+	if !ok {
+		u = &Usage{Model: model}
+		m.byModel[model] = u
+	}
+	u.Requests++
+	u.PromptTokens += promptTokens
+	u.CompletionTokens += completionTokens
+}
+
+func (m *usageMeter) usage() []Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var usage []Usage
+	for _, u := range m.byModel {
+		usage = append(usage, *u)
+	}
+	slices.SortFunc(usage, func(a, b Usage) int { return strings.Compare(a.Model, b.Model) })
+	return usage
+}
@@ -0,0 +1,77 @@
+package aihelpers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openai/openai-go/option"
+)
+
+func TestUsage_Cost(t *testing.T) {
+	u := Usage{Model: "gpt-4o-mini-2024-07-18", PromptTokens: 1_000_000, CompletionTokens: 500_000}
+	cost, ok := u.Cost()
+	if !ok {
+		t.Fatal("Expected the dated model to use the gpt-4o-mini price")
+	}
+	if math.Abs(cost-0.45) > 1e-9 {
+		t.Errorf("Expected a cost of 0.45, but got %v", cost)
+	}
+
+	if _, ok := (Usage{Model: "unknown-model"}).Cost(); ok {
+		t.Error("Expected no cost for an unknown model")
+	}
+}
+
+func TestPrices_Of(t *testing.T) {
+	client := NewOpenAIClient("test_api_key", "test_model")
+	client.Prices = Prices{"gpt-4o-mini": {Input: 1, Output: 1}, "local-llm": {}}
+
+	cost, ok := client.Cost(Usage{Model: "gpt-4o-mini-2024-07-18", PromptTokens: 1_000_000})
+	if !ok || cost != 1 {
+		t.Errorf("Expected the configured price to override the list price, but got %v, %v", cost, ok)
+	}
+	if cost, ok := client.Cost(Usage{Model: "gpt-4o", PromptTokens: 1_000_000}); !ok || cost != 2.5 {
+		t.Errorf("Expected the list price for models without a configured price, but got %v, %v", cost, ok)
+	}
+	if cost, ok := client.Cost(Usage{Model: "local-llm", PromptTokens: 1_000_000}); !ok || cost != 0 {
+		t.Errorf("Expected a free configured model, but got %v, %v", cost, ok)
+	}
+}
+
+func TestAIClient_Budget(t *testing.T) {
+	requests := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "ok"}}], "usage": {"prompt_tokens": 600, "completion_tokens": 100}}`))
+	}))
+	defer mockServer.Close()
+
+	client := NewOpenAIClient("test_api_key", "gpt-4o", option.WithBaseURL(mockServer.URL))
+	client.Budget = Budget{MaxTokens: 1000}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := client.Prompt(context.Background(), PromptRequest{Prompt: "hi"}); err != nil {
+			t.Fatalf("Expected request %d to be within budget, but got %v", i+1, err)
+		}
+	}
+	if _, _, err := client.Prompt(context.Background(), PromptRequest{Prompt: "hi"}); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded, but got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected no request to start once the budget is spent, but got %d requests", requests)
+	}
+
+	client.Budget = Budget{MaxCost: 0.001}
+	if err := client.CheckBudget(); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected 1400 tokens of gpt-4o to exceed $0.001, but got %v", err)
+	}
+	var none *AIClient
+	if err := none.CheckBudget(); err != nil {
+		t.Errorf("Expected a nil client to be within budget, but got %v", err)
+	}
+}
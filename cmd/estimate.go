@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"github.com/LarsOL/NeuroSpecation/aihelpers"
+	"github.com/spf13/viper"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// defaultOutputTokens is the expected length of an answer, for prompts that do not expect a shorter or longer one.
+const defaultOutputTokens = 800
+
+// dryRunEstimate adds up the requests a dry run would have sent, per target (directory or pull request) and model.
+type dryRunEstimate struct {
+	// promptDir, if set, receives a copy of every prompt
+	promptDir string
+
+	mu      sync.Mutex
+	model   string
+	usage   map[estimateKey]*aihelpers.Usage
+	prompts int
+}
+
+type estimateKey struct {
+	target string
+	model  string
+}
+
+type dryRunEstimateKey struct{}
+
+// startDryRun adds an estimate to ctx, which promptAI fills in instead of prompting.
+func startDryRun(ctx context.Context) (context.Context, error) {
+	e := &dryRunEstimate{model: viper.GetString(modelKey), usage: map[estimateKey]*aihelpers.Usage{}}
+	if viper.GetBool(dryRunPromptsKey) {
+		dir, err := os.MkdirTemp("", "neurospecation-prompts-")
+		if err != nil {
+			return ctx, fmt.Errorf("failed to create the prompt directory: %w", err)
+		}
+		e.promptDir = dir
+		slog.Info("Writing dry-run prompts", "dir", dir)
+	}
+	return context.WithValue(ctx, dryRunEstimateKey{}, e), nil
+}
+
+// estimateFromCtx returns the dry run estimate, or nil when not in a dry run.
+func estimateFromCtx(ctx context.Context) *dryRunEstimate {
+	e, _ := ctx.Value(dryRunEstimateKey{}).(*dryRunEstimate)
+	return e
+}
+
+// setModel changes the model the following prompts are estimated for.
+func (e *dryRunEstimate) setModel(model string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.model = model
+}
+
+// unsafeFileChars are replaced when a target is used in a prompt file name.
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// add counts the prompt as sent for the target of ctx.
+func (e *dryRunEstimate) add(ctx context.Context, prompt *guardedPrompt) {
+	if e == nil {
+		return
+	}
+	target := aihelpers.AuditTarget(ctx)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	model := e.model
+	if prompt.model != "" {
+		model = prompt.model
+	}
+	key := estimateKey{target: target, model: model}
+	u, ok := e.usage[key]
+	if !ok {
+		u = &aihelpers.Usage{Model: model}
+		e.usage[key] = u
+	}
+	u.Requests++
+	u.PromptTokens += int64(aihelpers.RequestTokens(model, prompt.request()))
+	u.CompletionTokens += int64(prompt.expectedOutput())
+
+	e.prompts++
+	if e.promptDir != "" {
+		name := fmt.Sprintf("%03d-%s.txt", e.prompts, strings.Trim(unsafeFileChars.ReplaceAllString(target, "_"), "._"))
+		if err := os.WriteFile(filepath.Join(e.promptDir, name), []byte(prompt.String()), 0o600); err != nil {
+			slog.Warn("Could not write the dry-run prompt", "file", name, "err", err)
+		}
+	}
+}
+
+// report prints the estimated requests, tokens and cost per target and in total.
+func (e *dryRunEstimate) report() {
+	if e == nil {
+		return
+	}
+	prices, err := configuredPrices()
+	if err != nil {
+		slog.Warn("Could not read the configured prices, using list prices", "err", err)
+	}
+	prices = aihelpers.ModelPrices.With(prices)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	keys := make([]estimateKey, 0, len(e.usage))
+	for k := range e.usage {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b estimateKey) int {
+		return cmp.Or(cmp.Compare(a.target, b.target), cmp.Compare(a.model, b.model))
+	})
+
+	var sb strings.Builder
+	sb.WriteString("| Target | Model | Requests | Input tokens | Output tokens (typical) | Projected cost |\n|---|---|---|---|---|---|\n")
+	var total aihelpers.Usage
+	var totalCost float64
+	unpriced := false
+	for _, k := range keys {
+		u := e.usage[k]
+		cost := "unknown"
+		if c, ok := u.CostAt(prices); ok {
+			cost = fmt.Sprintf("$%.4f", c)
+			totalCost += c
+		} else {
+			unpriced = true
+		}
+		sb.WriteString(fmt.Sprintf("| %s | %s | %d | %d | %d | %s |\n", cmp.Or(k.target, "-"), k.model, u.Requests, u.PromptTokens, u.CompletionTokens, cost))
+		total.Requests += u.Requests
+		total.PromptTokens += u.PromptTokens
+		total.CompletionTokens += u.CompletionTokens
+	}
+	totalText := fmt.Sprintf("$%.4f", totalCost)
+	if unpriced {
+		totalText += " + unknown"
+	}
+	sb.WriteString(fmt.Sprintf("| **Total** | | %d | %d | %d | %s |\n", total.Requests, total.PromptTokens, total.CompletionTokens, totalText))
+	sb.WriteString("\nInput tokens are counted with the model's tokenizer, output tokens are a typical answer length.\n")
+	fmt.Print(sb.String())
+
+	slog.Info("Dry-run estimate", "requests", total.Requests, "input_tokens", total.PromptTokens, "output_tokens", total.CompletionTokens, "cost", totalText)
+	if e.promptDir != "" {
+		slog.Info("Dry-run prompts written", "dir", e.promptDir, "count", e.prompts)
+	}
+}
@@ -2,22 +2,261 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/LarsOL/NeuroSpecation/aihelpers"
+	"github.com/LarsOL/NeuroSpecation/pathpolicy"
+	"github.com/LarsOL/NeuroSpecation/prompts"
 	"github.com/spf13/viper"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
-func promptAI(ctx context.Context, aiClient *aihelpers.AIClient, prompt string, dryRun bool) (string, error) {
+// newAIClient creates the client every prompt of a command goes through, rate limited and with secrets redacted.
+func newAIClient() (*aihelpers.AIClient, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, errors.New("API key is not set")
+	}
+	aiClient := aihelpers.NewOpenAIClient(apiKey, viper.GetString(modelKey))
+	aiClient.Limiter = aihelpers.NewRateLimiter(viper.GetInt(throttleKey))
+	if trustedConfig.GetBool(redactKey) {
+		redactor, err := aihelpers.NewRedactor(trustedConfig.GetStringSlice(redactPatternsKey))
+		if err != nil {
+			return nil, err
+		}
+		aiClient.Redactor = redactor
+	}
+	prices, err := configuredPrices()
+	if err != nil {
+		return nil, err
+	}
+	aiClient.Prices = prices
+	aiClient.Budget = aihelpers.Budget{MaxCost: viper.GetFloat64(maxCostKey), MaxTokens: viper.GetInt64(maxTokensKey)}
+	if aiClient.Budget.MaxCost > 0 {
+		if _, ok := aiClient.Cost(aihelpers.Usage{Model: aiClient.Model}); !ok {
+			slog.Warn("The model has no known price, its requests do not count towards --max-cost; add it to prices in the config file", "model", aiClient.Model)
+		}
+	}
+	if trustedConfig.GetBool(auditKey) {
+		audit, err := newAuditLog()
+		if err != nil {
+			return nil, err
+		}
+		aiClient.Audit = audit
+	}
+	return aiClient, nil
+}
+
+// newAuditLog opens the audit log, kept outside the repository by default so it survives and is not committed.
+func newAuditLog() (*aihelpers.AuditLog, error) {
+	path := trustedConfig.GetString(auditLogKey)
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the audit log directory: %w", err)
+		}
+		path = filepath.Join(home, ".neurospecation", "audit.jsonl")
+	}
+	audit, err := aihelpers.NewAuditLog(path, trustedConfig.GetString(providerKey), int64(trustedConfig.GetInt(auditMaxSizeKey))<<20, trustedConfig.GetInt(auditMaxFilesKey))
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("Auditing AI requests", "path", path)
+	return audit, nil
+}
+
+// configuredPrices are the model prices set in the config file, on top of the list prices.
+func configuredPrices() (aihelpers.Prices, error) {
+	var prices aihelpers.Prices
+	if err := viper.UnmarshalKey(pricesKey, &prices); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", pricesKey, err)
+	}
+	return prices, nil
+}
+
+// logUsage prints the tokens used per model and their estimated cost, once the command is done.
+func logUsage(aiClient *aihelpers.AIClient) {
+	if aiClient == nil {
+		return
+	}
+	for _, u := range aiClient.Usage() {
+		attrs := []any{"model", u.Model, "requests", u.Requests, "prompt_tokens", u.PromptTokens, "completion_tokens", u.CompletionTokens}
+		if cost, ok := aiClient.Cost(u); ok {
+			attrs = append(attrs, "cost", fmt.Sprintf("$%.4f", cost))
+		} else {
+			attrs = append(attrs, "cost", "unknown")
+		}
+		slog.Info("AI usage", attrs...)
+	}
+	if tokens, cost := aiClient.Spent(); tokens > 0 {
+		slog.Info("AI usage total", "tokens", tokens, "cost", fmt.Sprintf("$%.4f", cost))
+	}
+}
+
+// exitOnBudget exits with exitCodeBudget if the command failed because, or went over, the AI budget.
+func exitOnBudget(aiClient *aihelpers.AIClient, err error) {
+	if err == nil {
+		err = aiClient.CheckBudget()
+	}
+	if errors.Is(err, aihelpers.ErrBudgetExceeded) {
+		slog.Error("AI budget exceeded", "err", err)
+		os.Exit(exitCodeBudget)
+	}
+}
+
+// loadPrompts loads the prompt templates, see promptOverrides, and validates every one of them before use: a template
+// placing repository data in the instructions would bypass the delimiters and the redaction of the user message.
+func loadPrompts(dir, rev string) (prompts.Set, error) {
+	set, err := prompts.LoadAll(promptOverrides(dir, rev)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range prompts.Names {
+		t := set[name]
+		if err := t.Validate(); err != nil {
+			return nil, err
+		}
+		if t.Origin != "built-in" {
+			slog.Info("Using prompt template", "name", name, "origin", t.Origin)
+		}
+	}
+	return set, nil
+}
+
+// promptOverrides lists where the prompt templates are overridden: first the files set in the config, then the
+// repository's .neurospecation/prompts directory. With rev set, files in the repository are read at that revision,
+// so a pull request cannot change the instructions its own review runs with.
+func promptOverrides(dir, rev string) []prompts.Override {
+	root, err := getGitRoot(dir)
+	if err != nil {
+		root = dir
+	}
+	configured := prompts.FromFiles(viper.GetStringMapString(promptsKey))
+	if rev == "" {
+		return []prompts.Override{configured, prompts.FromDir(filepath.Join(root, prompts.Dir))}
+	}
+
+	atRev := func(path string) ([]byte, string, error) {
+		content, err := getGitFileAtRev(dir, rev, path)
+		if err != nil {
+			slog.Debug("No prompt template override", "path", path, "rev", rev, "err", err)
+			return nil, "", fs.ErrNotExist
+		}
+		return []byte(content), rev + ":" + path, nil
+	}
+	files := viper.GetStringMapString(promptsKey)
+	return []prompts.Override{
+		func(name string) ([]byte, string, error) {
+			rel, inRepo := repoRelative(root, files[name])
+			if files[name] == "" || !inRepo {
+				// Files outside the repository are not part of the pull request
+				return configured(name)
+			}
+			return atRev(rel)
+		},
+		func(name string) ([]byte, string, error) {
+			return atRev(prompts.Dir + "/" + name + ".tmpl")
+		},
+	}
+}
+
+// repoRelative returns path relative to the repository root, and whether it is inside the repository.
+func repoRelative(root, path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absRoot, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// loadPathPolicy reads the path policy for the configured provider, returning nil if the repository has none.
+// With rev set the repository's policy is read as of that revision, so a pull request cannot loosen the policy that
+// applies to its own content.
+func loadPathPolicy(dir, rev string) (*pathpolicy.Policy, error) {
+	root, err := getGitRoot(dir)
+	if err != nil {
+		// Not a repository, the patterns are relative to the directory being processed
+		root = dir
+	}
+	provider := trustedConfig.GetString(providerKey)
+	path := trustedConfig.GetString(pathPolicyKey)
+	var paths *pathpolicy.Policy
+	switch {
+	case path != "":
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("failed to read path policy: %w", err)
+		}
+		paths, err = pathpolicy.Load(path, root, provider)
+	case rev != "":
+		path = rev + ":" + pathpolicy.FileName
+		content, gitErr := getGitFileAtRev(dir, rev, pathpolicy.FileName)
+		if gitErr != nil {
+			slog.Debug("No path policy", "path", path, "err", gitErr)
+			return nil, nil
+		}
+		paths, err = pathpolicy.Parse([]byte(content), path, root, provider)
+	default:
+		path = filepath.Join(root, pathpolicy.FileName)
+		paths, err = pathpolicy.Load(path, root, provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if paths != nil {
+		slog.Info("Loaded path policy", "path", path, "provider", paths.Provider(), "mode", paths.Mode())
+	}
+	return paths, nil
+}
+
+// writePathAudit logs what the path policy withheld and writes it to ai_path_audit.json, for compliance records.
+func writePathAudit(dir string, paths *pathpolicy.Policy) {
+	if paths == nil {
+		return
+	}
+	withheld := paths.Withheld()
+	for _, w := range withheld {
+		slog.Info("Withheld by path policy", "path", w.Path, "rule", w.Rule, "mode", w.Mode, "source", w.Source)
+	}
+
+	auditPath := filepath.Join(dir, "ai_path_audit.json")
+	if viper.GetBool(dryRunKey) {
+		slog.Debug("skipping path policy audit, would have written file to:", "path", auditPath)
+		return
+	}
+	audit := struct {
+		Provider string                `json:"provider"`
+		Withheld []pathpolicy.Withheld `json:"withheld"`
+	}{paths.Provider(), withheld}
+	content, err := json.MarshalIndent(audit, "", "  ")
+	if err == nil {
+		err = os.WriteFile(auditPath, append(content, '\n'), 0o644)
+	}
+	if err != nil {
+		slog.Warn("Could not write the path policy audit", "path", auditPath, "err", err)
+	}
+}
+
+func promptAI(ctx context.Context, aiClient *aihelpers.AIClient, prompt *guardedPrompt, dryRun bool) (string, error) {
 	if dryRun {
 		slog.Debug("Dry-run mode, skipping AI prompt")
+		estimateFromCtx(ctx).add(ctx, prompt)
 		return "", nil
 	}
-	loggerFromCtx(ctx).Debug("Prompting AI", "prompt", prompt)
-	ans, resp, err := aiClient.Prompt(ctx, aihelpers.PromptRequest{Prompt: prompt})
+	loggerFromCtx(ctx).Debug("Prompting AI", "prompt", prompt.String())
+	ans, resp, err := aiClient.Prompt(ctx, prompt.request())
 	if viper.GetBool(debugKey) {
 		slog.Debug("openai resp", "resp", resp)
 	}
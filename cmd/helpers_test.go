@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/LarsOL/NeuroSpecation/pathpolicy"
+	"github.com/spf13/viper"
+)
+
+// testRepo is a git repository in a temporary directory.
+type testRepo struct {
+	t   *testing.T
+	Dir string
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	r := &testRepo{t: t, Dir: t.TempDir()}
+	r.git("init", "-q", "-b", "main")
+	return r
+}
+
+func (r *testRepo) git(args ...string) string {
+	r.t.Helper()
+	cmd := runGitCommand(r.Dir, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %v failed: %v: %s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// commit writes the files, removing those with empty content, and commits them, returning the commit SHA.
+func (r *testRepo) commit(files map[string]string) string {
+	r.t.Helper()
+	for name, content := range files {
+		path := filepath.Join(r.Dir, name)
+		if content == "" {
+			if err := os.Remove(path); err != nil {
+				r.t.Fatalf("Failed to remove %s: %v", name, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			r.t.Fatalf("Failed to create the directory of %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			r.t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	r.git("add", "-A")
+	r.git("commit", "-q", "--allow-empty", "-m", "commit")
+	return r.git("rev-parse", "HEAD")
+}
+
+// useTrustedConfig replaces trustedConfig for the test with one bound to the root flags, their defaults included.
+func useTrustedConfig(t *testing.T) *viper.Viper {
+	t.Helper()
+	v := viper.New()
+	for _, key := range trustedKeys {
+		if err := v.BindPFlag(key, rootCmd.PersistentFlags().Lookup(key)); err != nil {
+			t.Fatalf("Failed to bind %s: %v", key, err)
+		}
+	}
+	previous := trustedConfig
+	trustedConfig = v
+	t.Cleanup(func() { trustedConfig = previous })
+	return v
+}
+
+func TestReadConfig_TrustedKeys(t *testing.T) {
+	const basePolicy = "default:\n  deny: [\"secret/\"]\n"
+	repo := newTestRepo(t)
+	base := repo.commit(map[string]string{pathpolicy.FileName: basePolicy})
+	// The pull request points the policy at a file it controls and turns redaction and auditing off
+	repo.commit(map[string]string{
+		"open.yaml":            "default: {}\n",
+		".neurospecation.yaml": "path-policy: open.yaml\nprovider: local\nredact: false\naudit: false\nmodel: o3\n",
+	})
+
+	testCases := map[string]struct {
+		home         string
+		wantProvider string
+		wantWithheld bool
+	}{
+		"repository config is ignored": {wantProvider: "openai", wantWithheld: true},
+		"home config is read": {
+			home:         "provider: local\n",
+			wantProvider: "local",
+			wantWithheld: true,
+		},
+		"home config may set the policy": {
+			home:         "path-policy: " + filepath.Join(repo.Dir, "open.yaml") + "\n",
+			wantProvider: "openai",
+			wantWithheld: false,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			home := t.TempDir()
+			if tc.home != "" {
+				if err := os.WriteFile(filepath.Join(home, ".neurospecation.yaml"), []byte(tc.home), 0o644); err != nil {
+					t.Fatalf("Failed to write the home config: %v", err)
+				}
+			}
+			trusted := useTrustedConfig(t)
+			config := viper.New()
+			if err := readConfig(config, "", home, repo.Dir); err != nil {
+				t.Fatalf("Expected a config file to be found, but got: %v", err)
+			}
+			_ = readConfig(trusted, "", home)
+
+			if tc.home == "" && config.GetString(modelKey) != "o3" {
+				t.Errorf("Expected the repository config to apply to the other settings, but got model %q", config.GetString(modelKey))
+			}
+			if !trusted.GetBool(redactKey) || !trusted.GetBool(auditKey) {
+				t.Errorf("Expected redaction and auditing to stay on, but got redact %v, audit %v", trusted.GetBool(redactKey), trusted.GetBool(auditKey))
+			}
+			if got := trusted.GetString(providerKey); got != tc.wantProvider {
+				t.Errorf("Expected provider %s, but got %s", tc.wantProvider, got)
+			}
+
+			paths, err := loadPathPolicy(repo.Dir, base)
+			if err != nil {
+				t.Fatalf("Expected no error, but got: %v", err)
+			}
+			if ok, _ := paths.Check("secret/key.pem"); ok == tc.wantWithheld {
+				t.Errorf("Expected secret/key.pem withheld: %v, but got %v", tc.wantWithheld, !ok)
+			}
+		})
+	}
+}
+
+func TestLoadPathPolicy(t *testing.T) {
+	repo := newTestRepo(t)
+	empty := repo.commit(map[string]string{"README.md": "readme\n"})
+	base := repo.commit(map[string]string{
+		pathpolicy.FileName: "default:\n  deny: [\"secret/\"]\nproviders:\n  local: {}\n",
+		"other.yaml":        "default:\n  deny: [\"other/\"]\n",
+	})
+	// The pull request drops the deny rule, and the working tree has an uncommitted policy of its own
+	head := repo.commit(map[string]string{pathpolicy.FileName: "default: {}\n"})
+	if err := os.WriteFile(filepath.Join(repo.Dir, pathpolicy.FileName), []byte("default:\n  deny: [\"wip/\"]\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write the working tree policy: %v", err)
+	}
+
+	testCases := map[string]struct {
+		rev      string
+		policy   string
+		provider string
+		withheld []string
+		noPolicy bool
+		wantErr  bool
+	}{
+		"head changes are ignored":   {rev: base, withheld: []string{"secret/key.pem"}},
+		"head revision policy":       {rev: head},
+		"no policy at the revision":  {rev: empty, noPolicy: true},
+		"working tree without a rev": {withheld: []string{"wip/notes.md"}},
+		"provider rules":             {rev: base, provider: "local"},
+		"explicit policy wins":       {rev: base, policy: "other.yaml", withheld: []string{"other/file.go"}},
+		"explicit policy must exist": {rev: base, policy: "missing.yaml", wantErr: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			trusted := useTrustedConfig(t)
+			if tc.policy != "" {
+				trusted.Set(pathPolicyKey, filepath.Join(repo.Dir, tc.policy))
+			}
+			if tc.provider != "" {
+				trusted.Set(providerKey, tc.provider)
+			}
+
+			paths, err := loadPathPolicy(repo.Dir, tc.rev)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error: %v, but got: %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if (paths == nil) != tc.noPolicy {
+				t.Fatalf("Expected no policy: %v, but got %v", tc.noPolicy, paths)
+			}
+			for _, path := range []string{"secret/key.pem", "wip/notes.md", "other/file.go", "main.go"} {
+				ok, _ := paths.Check(path)
+				if want := slices.Contains(tc.withheld, path); ok == want {
+					t.Errorf("Expected %s withheld: %v, but got %v", path, want, !ok)
+				}
+			}
+		})
+	}
+}
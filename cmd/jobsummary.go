@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// appendJobSummary adds markdown to the GitHub Actions job summary, it does nothing outside GitHub Actions.
+func appendJobSummary(markdown string) error {
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		slog.Debug("no job summary file set (GITHUB_STEP_SUMMARY)")
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open job summary: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(markdown + "\n"); err != nil {
+		return fmt.Errorf("failed to write job summary: %w", err)
+	}
+	return nil
+}
+
+// setStepOutputs writes GitHub Actions step outputs, it does nothing outside GitHub Actions.
+// Values must be single lines.
+func setStepOutputs(outputs map[string]string) error {
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		slog.Debug("no step output file set (GITHUB_OUTPUT)")
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open step outputs: %w", err)
+	}
+	defer f.Close()
+
+	names := slices.Sorted(maps.Keys(outputs))
+	for _, name := range names {
+		value := strings.ReplaceAll(outputs[name], "\n", " ")
+		if _, err := fmt.Fprintf(f, "%s=%s\n", name, value); err != nil {
+			return fmt.Errorf("failed to write step outputs: %w", err)
+		}
+	}
+	return nil
+}
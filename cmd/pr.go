@@ -2,15 +2,22 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/LarsOL/NeuroSpecation/aihelpers"
-	"github.com/google/go-github/v69/github"
+	"github.com/LarsOL/NeuroSpecation/codecontext"
+	"github.com/LarsOL/NeuroSpecation/codehost"
+	"github.com/LarsOL/NeuroSpecation/guidelines"
+	"github.com/LarsOL/NeuroSpecation/pathpolicy"
+	"github.com/LarsOL/NeuroSpecation/policy"
+	"github.com/LarsOL/NeuroSpecation/review"
 	"github.com/spf13/viper"
 	"log/slog"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -33,7 +40,7 @@ var prCmd = &cobra.Command{
 		}))
 		slog.SetDefault(l)
 
-		ctx := context.Background()
+		ctx := cmd.Context()
 		ctx = setLoggerToCtx(ctx, l)
 
 		slog.Info("Command line arguments", "args", os.Args)
@@ -42,10 +49,13 @@ var prCmd = &cobra.Command{
 			slog.Debug("directory command line argument not set")
 			directory = os.Getenv("GITHUB_WORKSPACE")
 			if directory == "" {
-				slog.Debug("GITHUB_WORKSPACE argument not set, using current directory")
+				directory = os.Getenv("CI_PROJECT_DIR")
+			}
+			if directory == "" {
+				slog.Debug("GITHUB_WORKSPACE or CI_PROJECT_DIR argument not set, using current directory")
 				directory = "."
 			} else {
-				slog.Debug("using directory from GITHUB_WORKSPACE", "dir", directory)
+				slog.Debug("using directory from CI workspace", "dir", directory)
 			}
 		} else {
 			slog.Debug("using directory from cmd argument", "dir", directory)
@@ -53,22 +63,35 @@ var prCmd = &cobra.Command{
 
 		if viper.GetBool(dryRunKey) {
 			slog.Info("Dry-run mode enabled")
+			var err error
+			ctx, err = startDryRun(ctx)
+			if err != nil {
+				slog.Error("Could not start the dry run", "err", err)
+				os.Exit(1)
+			}
 		} else {
 			slog.Debug("Dry-run mode disabled")
 		}
 
 		var aiClient *aihelpers.AIClient
 		if !viper.GetBool(dryRunKey) {
-			apiKey := os.Getenv("OPENAI_API_KEY")
-			if apiKey == "" {
-				slog.Error("API key is not set")
+			var err error
+			aiClient, err = newAIClient()
+			if err != nil {
+				slog.Error("Could not create the AI client", "err", err)
 				os.Exit(1)
 			}
-			aiClient = aihelpers.NewOpenAIClient(apiKey, viper.GetString(modelKey))
 		}
 
 		slog.Info("Creating PR review")
 		err := ReviewPullRequests(ctx, directory, aiClient)
+		logUsage(aiClient)
+		estimateFromCtx(ctx).report()
+		exitOnBudget(aiClient, err)
+		if onlyFindingsAtThreshold(err) {
+			slog.Error("Review found blocking issues", "err", err)
+			os.Exit(exitCodeFindings)
+		}
 		if err != nil {
 			slog.Error("Error reviewing pull requests", "err", err)
 			os.Exit(1)
@@ -78,11 +101,88 @@ var prCmd = &cobra.Command{
 }
 
 const targetBranchKey = "target-branch"
+const hostKey = "host"
+const hostURLKey = "host-url"
+const hostTokenKey = "host-token"
+const repoKey = "repo"
+const prNumberKey = "pr-number"
+const githubAPIURLKey = "github-api-url"
+const githubUploadURLKey = "github-upload-url"
+const githubAppIDKey = "github-app-id"
+const githubAppInstallationIDKey = "github-app-installation-id"
+const githubAppPrivateKeyKey = "github-app-private-key"
+const publishKey = "publish"
+const formatKey = "format"
+const failOnKey = "fail-on"
+const fullReviewKey = "full-review"
+const triageKey = "triage"
+const labelsKey = "labels"
+const maxReviewersKey = "max-reviewers"
+const skipDraftsKey = "skip-drafts"
+const skipAuthorsKey = "skip-authors"
+const skipLabelsKey = "skip-labels"
+const minChangedLinesKey = "min-changed-lines"
+const maxChangedLinesKey = "max-changed-lines"
+const maxChangedFilesKey = "max-changed-files"
+const lightAuthorsKey = "light-authors"
+const lightLabelsKey = "light-labels"
+const lightMaxLinesKey = "light-max-lines"
+const smallModelKey = "small-model"
+const contextBudgetKey = "context-budget"
+const guidelinesKey = "guidelines"
+const guidelinesBudgetKey = "guidelines-budget"
+
+const reviewersKey = "reviewers"
+
+// personasKey is a config file only setting, adding reviewer personas or changing the focus and model of built-in ones
+const personasKey = "personas"
+
+// rulesKey is a config file only setting, listing the review rules with their id, paths and rule
+const rulesKey = "rules"
+
+// maxContextReferences bounds the references gathered per changed exported symbol
+const maxContextReferences = 5
+
+const (
+	formatMarkdown = "markdown"
+	formatSARIF    = "sarif"
+)
 
 func init() {
 	rootCmd.AddCommand(prCmd)
 
 	prCmd.PersistentFlags().String(targetBranchKey, "", "Target branch for pull request reviews")
+	prCmd.PersistentFlags().String(hostKey, "", "Code host to post the review to: github|gitlab|gitea|bitbucket (default: detected from CI environment)")
+	prCmd.PersistentFlags().String(hostURLKey, "", "Base URL of the code host server, required for gitea and bitbucket")
+	prCmd.PersistentFlags().String(hostTokenKey, "", "Token used to post to the code host (default: GITHUB_TOKEN, GITLAB_TOKEN, GITEA_TOKEN or BITBUCKET_TOKEN)")
+	prCmd.PersistentFlags().String(repoKey, "", "Repository to review as owner/repo (gitea) or PROJECT/repo (bitbucket)")
+	prCmd.PersistentFlags().Int(prNumberKey, 0, "Pull request number, when not provided by the CI environment")
+	prCmd.PersistentFlags().String(githubAPIURLKey, "", "GitHub Enterprise Server API URL, e.g. https://github.example.com/api/v3/ (default: GITHUB_API_URL)")
+	prCmd.PersistentFlags().String(githubUploadURLKey, "", "GitHub Enterprise Server upload URL (default: the API URL)")
+	prCmd.PersistentFlags().Int64(githubAppIDKey, 0, "GitHub App ID to post reviews as (default: GITHUB_APP_ID)")
+	prCmd.PersistentFlags().Int64(githubAppInstallationIDKey, 0, "GitHub App installation ID (default: GITHUB_APP_INSTALLATION_ID, or looked up from the repository)")
+	prCmd.PersistentFlags().String(githubAppPrivateKeyKey, "", "Path to the GitHub App private key (default: PEM contents of GITHUB_APP_PRIVATE_KEY)")
+	prCmd.PersistentFlags().String(formatKey, formatMarkdown, "Format of the local review file: markdown (ai_Review.md, when not posting to a PR) or sarif (ai_Review.sarif, always written)")
+	prCmd.PersistentFlags().String(failOnKey, "", "Exit with code 2 when findings at or above this severity are found: critical|high|medium")
+	prCmd.PersistentFlags().Bool(fullReviewKey, false, "Review the whole pull request, instead of only the commits pushed since the last review")
+	prCmd.PersistentFlags().String(triageKey, triageOff, "Label the PR and request reviewers: off|preview|apply, preview only prints the suggestions")
+	prCmd.PersistentFlags().StringToString(labelsKey, nil, "Labels to apply per change category, e.g. bug=bug,feature=enhancement. Categories: "+strings.Join(triageCategories, ", "))
+	prCmd.PersistentFlags().Int(maxReviewersKey, 2, "Maximum number of reviewers to request from CODEOWNERS")
+	prCmd.PersistentFlags().Bool(skipDraftsKey, true, "Skip draft pull requests until they are marked ready for review")
+	prCmd.PersistentFlags().StringSlice(skipAuthorsKey, []string{"renovate[bot]", "dependabot[bot]"}, "Skip pull requests by authors matching these globs")
+	prCmd.PersistentFlags().StringSlice(skipLabelsKey, nil, "Skip pull requests with any of these labels")
+	prCmd.PersistentFlags().Int(minChangedLinesKey, 0, "Skip pull requests changing fewer lines (0: no minimum)")
+	prCmd.PersistentFlags().Int(maxChangedLinesKey, 0, "Skip pull requests changing more lines (0: no maximum)")
+	prCmd.PersistentFlags().Int(maxChangedFilesKey, 0, "Skip pull requests changing more files (0: no maximum)")
+	prCmd.PersistentFlags().StringSlice(lightAuthorsKey, nil, "Only review, with --small-model, pull requests by authors matching these globs")
+	prCmd.PersistentFlags().StringSlice(lightLabelsKey, nil, "Only review, with --small-model, pull requests with any of these labels")
+	prCmd.PersistentFlags().Int(lightMaxLinesKey, 0, "Only review, with --small-model, pull requests changing at most this many lines (0: off)")
+	prCmd.PersistentFlags().String(smallModelKey, "", "Cheaper model used for light reviews, e.g. gpt-4o-mini (default: --model)")
+	prCmd.PersistentFlags().Int(contextBudgetKey, 24000, "Maximum size in bytes of the Go code added to the review around the changes: enclosing declarations and references to changed symbols (0: off)")
+	prCmd.PersistentFlags().StringSlice(guidelinesKey, nil, "Guideline documents the review enforces, as gitignore style patterns, e.g. CONTRIBUTING.md,docs/adr/ (added to the sources in "+guidelines.FileName+")")
+	prCmd.PersistentFlags().Int(guidelinesBudgetKey, 16000, "Maximum size in bytes of the guideline documents added to the review (0: rules only)")
+	prCmd.PersistentFlags().StringSlice(reviewersKey, nil, "Split the review into parallel passes by these personas: "+strings.Join(slices.Sorted(maps.Keys(review.Personas)), ", ")+", or ones defined under personas in the config (default: a single general review)")
+	prCmd.PersistentFlags().String(publishKey, publishComment, "How to publish the review: comment|check|both, check runs are only supported on GitHub")
 
 	err := viper.BindPFlags(prCmd.PersistentFlags())
 	if err != nil {
@@ -92,170 +192,272 @@ func init() {
 
 }
 
-const ReviewPrompt = "You are a seasoned senior staff software engineer with extensive experience in software architecture, code quality, security, and performance optimization. Your task is to review the following pull request thoroughly. Structure your feedback in two clearly delineated sections:\n\n1. **High-Level Architectural Concerns**:  \n   - Evaluate the overall design and integration of the changes within the context of the existing system architecture.\n   - Identify any issues that might affect scalability, maintainability, or long-term stability.\n   - Consider how the changes align with project goals and overall technical strategy.\n\n2. **Code-Level Improvements**:  \n   - Examine the implementation details, coding standards, and best practices.\n   - Identify potential bugs, inefficiencies, or security vulnerabilities.\n   - Suggest improvements for performance, error handling, clarity, and testing.\n   - Provide recommendations that are actionable and aligned with industry best practices.\n\nRemember to also consider non-functional aspects such as security, performance, and testing in both sections.\n\nYou will receive two parts of information:\n- **Repository Context**: A brief summary of the project’s purpose, architecture, and any important context.\n- **Pull Request Details**: The title, description, and the Git diff containing the code changes.\n\nProceed with the review based on the details provided below:\n"
-const PRDescriptionPrompt = "You are an seasoned senior staff software engineer. The following pull request lacks a description, so your task is to generate a clear, concise, and useful description for it. Your description should be written in Markdown format and should include:\n\n- **Purpose of the PR**: A brief explanation of what this pull request aims to achieve.\n- **Key Changes**: A summary of the most important modifications (e.g., bug fixes, new features, refactoring, performance improvements, security enhancements).\n- **Context and Impact**: Any relevant background or context that helps reviewers understand the significance of the changes, including potential impacts on the system architecture, performance, or maintainability.\n- **Additional Notes**: Any extra information that might be helpful for reviewers (e.g., testing considerations, deployment notes).\n\nYou will be provided with the pull request title, repository context, and the Git diff of the changes. Use these details to craft your description.\n"
-
 func ReviewPullRequests(ctx context.Context, dir string, aiClient *aihelpers.AIClient) error {
-	targetBranch := viper.GetString(targetBranchKey)
-	if targetBranch == "" {
-		slog.Debug("no target branch flag set")
-		targetBranch = os.Getenv("GITHUB_BASE_REF")
-		if targetBranch == "" {
-			slog.Debug("no target branch github env set (GITHUB_BASE_REF)")
-			defaultBranchName, err := getDefaultBranch(dir)
-			if err != nil {
-				return err
-			}
-			targetBranch = defaultBranchName
-		} else {
-			slog.Debug("target branch github env set (GITHUB_BASE_REF)", "env", targetBranch)
+	format := viper.GetString(formatKey)
+	if format != formatMarkdown && format != formatSARIF {
+		return fmt.Errorf("unknown format %q, expected markdown or sarif", format)
+	}
+
+	var failOn review.Severity
+	if v := viper.GetString(failOnKey); v != "" {
+		var err error
+		failOn, err = review.ParseSeverity(v)
+		if err != nil {
+			return fmt.Errorf("invalid --%s: %w", failOnKey, err)
 		}
 	}
 
-	if viper.GetBool(debugKey) {
-		debug(dir)
+	personas, err := reviewPersonas()
+	if err != nil {
+		return fmt.Errorf("invalid --%s: %w", reviewersKey, err)
 	}
 
-	if !isInsideGitRepo(dir) {
-		return fmt.Errorf("must be run from within a git repo")
+	switch t := viper.GetString(triageKey); t {
+	case triageOff, triagePreview, triageApply:
+	default:
+		return fmt.Errorf("unknown triage mode %q, expected off, preview or apply", t)
 	}
 
-	diffOutput, err := getGitDiff(dir, targetBranch)
-	if err != nil {
-		return err
+	if viper.GetBool(debugKey) {
+		debug(dir)
 	}
 
-	if diffOutput == "" {
-		return fmt.Errorf("no diff between current commit and %s", targetBranch)
+	if !isInsideGitRepo(dir) {
+		return fmt.Errorf("must be run from within a git repo")
 	}
 
-	gitRoot, err := getGitRoot(dir)
+	host, canPost, err := newCodeHost(ctx)
 	if err != nil {
 		return err
 	}
 
-	prompt, err := createReviewPrompt(ctx, gitRoot, diffOutput)
+	pr, err := host.GetPRInfo(ctx)
 	if err != nil {
 		return err
 	}
 
-	if viper.GetBool(logPromptKey) {
-		if err := logPromptToFile(dir, "ai_review_prompt.txt", prompt); err != nil {
+	// Comment events only trigger work for /neuro commands from trusted commenters
+	var trigger *codehost.Comment
+	var command neuroCommand
+	conv, isConversation := host.(codehost.ConversationHost)
+	if isConversation && pr != nil {
+		trigger, err = conv.TriggerComment(ctx)
+		if err != nil {
 			return err
 		}
+		if trigger == nil && slices.Contains([]string{"issue_comment", "pull_request_review_comment"}, os.Getenv("GITHUB_EVENT_NAME")) {
+			slog.Info("Comment was edited or deleted, nothing to do")
+			return nil
+		}
+	}
+	if trigger != nil {
+		var ok bool
+		command, ok = parseNeuroCommand(trigger.Body)
+		if !ok {
+			slog.Info("Comment is not a /neuro command, nothing to do", "author", trigger.Author)
+			return nil
+		}
+		if !isTrustedCommenter(trigger) {
+			slog.Warn("Ignoring /neuro command from an untrusted commenter", "author", trigger.Author, "association", trigger.AuthorAssociation)
+			return nil
+		}
+		slog.Info("Handling command", "command", command.Name, "author", trigger.Author)
 	}
 
-	reviewOutput, err := promptAI(ctx, aiClient, prompt, viper.GetBool(dryRunKey))
+	base, head, err := getDiffRange(dir, pr)
 	if err != nil {
 		return err
 	}
+	if pr != nil {
+		ctx = aihelpers.WithAuditTarget(ctx, fmt.Sprintf("#%d", pr.Number))
+	} else {
+		ctx = aihelpers.WithAuditTarget(ctx, base+".."+head)
+	}
 
-	if os.Getenv("GITHUB_TOKEN") == "" {
-		err := writeReviewFile(dir, reviewOutput, viper.GetBool(dryRunKey))
+	if pr != nil && pr.HeadSHA == "" {
+		pr.HeadSHA, err = getGitRev(dir, head)
 		if err != nil {
 			return err
 		}
-	} else {
-		var descriptionOutput string
-		_, body, err := getPRInfo(ctx)
-		if body == "" {
-			// TODO: Hacky, split into separate, concurrent, code paths
-			p := PRDescriptionPrompt + strings.TrimPrefix(prompt, ReviewPrompt)
-			descriptionOutputOrg, err := promptAI(ctx, aiClient, p, viper.GetBool(dryRunKey))
-			if err != nil {
-				return err
-			}
-
-			descriptionOutput, err = extractBlock(descriptionOutputOrg, "markdown")
-			if err != nil {
-				slog.Error("Expected PR description output to contain a markdown file", "err", err)
-			}
-		}
+	}
 
-		err = writeReviewToPR(ctx, reviewOutput, descriptionOutput)
+	// Follow-up reviews only cover the commits pushed since the last review
+	var prior *priorReview
+	if canPost && pr != nil && (trigger == nil || command.Name == "rereview") {
+		force := viper.GetBool(fullReviewKey) || command.Arg == "full"
+		prior, err = findPriorReview(ctx, host, pr, dir, force)
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
-}
+	diffOutput, err := getGitDiff(dir, base, head)
+	if err != nil {
+		return err
+	}
+	if diffOutput == "" {
+		return fmt.Errorf("no diff between %s and %s", head, base)
+	}
 
-func writeReviewToPR(ctx context.Context, reviewOutput, descriptionOutput string) error {
-	client := github.NewClient(nil).WithAuthToken(os.Getenv("GITHUB_TOKEN"))
+	gitRoot, err := getGitRoot(dir)
+	if err != nil {
+		return err
+	}
 
-	repo := os.Getenv("GITHUB_REPOSITORY")
-	prNumber := os.Getenv("GITHUB_PR_NUMBER")
+	// The policy is read from the base branch, a pull request cannot loosen what may be sent of its own content
+	paths, err := loadPathPolicy(dir, base)
+	if err != nil {
+		return err
+	}
+	defer writePathAudit(dir, paths)
+	diffOutput = paths.FilterDiff(diffOutput, "diff")
+	if diffOutput == "" {
+		slog.Info("All changes are withheld by the path policy, nothing to review", "provider", paths.Provider())
+		return nil
+	}
 
-	if repo == "" {
-		return fmt.Errorf("GITHUB_REPOSITORY environment variable is not set")
+	// Templates are read from the base branch, a pull request changing them is reviewed with the current ones
+	templates, err := loadPrompts(dir, base)
+	if err != nil {
+		return err
 	}
-	if prNumber == "" {
-		return fmt.Errorf("GITHUB_PR_NUMBER environment variable is not set")
+
+	prc := &prContext{
+		Dir:        dir,
+		GitRoot:    gitRoot,
+		PR:         pr,
+		Diff:       diffOutput,
+		Knowledge:  gatherKnowledge(gitRoot, diffOutput, paths),
+		Prior:      prior,
+		ReviewDiff: diffOutput,
+		Report:     &runReport{},
+		Paths:      paths,
+		Prompts:    templates,
+		PRTemplate: readPRTemplate(dir, base),
 	}
 
-	ownerRepo := strings.Split(repo, "/")
-	if len(ownerRepo) != 2 {
-		return fmt.Errorf("invalid GITHUB_REPOSITORY format, got %s", repo)
+	if trigger != nil && command.Name != "rereview" {
+		prc.CodeContext = gatherCodeContext(gitRoot, diffOutput, paths)
+		return answerNeuroCommand(ctx, conv, host, prc, trigger, command, aiClient)
 	}
 
-	owner, repoName := ownerRepo[0], ownerRepo[1]
-	prNum, err := strconv.Atoi(prNumber)
-	if err != nil {
-		return fmt.Errorf("invalid GITHUB_PR_NUMBER format, got %s: err: %w", prNumber, err)
+	// Explicit /neuro rereview commands are not subject to the policy
+	decision := policy.Decision{Action: policy.ActionReview}
+	if trigger == nil {
+		decision, err = applyReviewPolicy(ctx, pr, diffOutput, aiClient)
+		if err != nil {
+			return err
+		}
+		if decision.Action == policy.ActionSkip {
+			return nil
+		}
 	}
 
-	if viper.GetBool(debugKey) {
-		// Print context of PR & check we at least have read permission
-		pr, _, err := client.PullRequests.Get(ctx, owner, repoName, prNum)
+	if prior != nil {
+		prc.ReviewDiff, err = getInterdiff(dir, base, prior.SHA, head)
 		if err != nil {
-			slog.Error("unable to get pr", "err", err)
+			return err
+		}
+		prc.ReviewDiff = paths.FilterDiff(prc.ReviewDiff, "diff")
+		if prc.ReviewDiff == "" {
+			slog.Info("No changes to the pull request files since the last review", "since", prior.SHA)
+			return nil
 		}
-		slog.Debug("Adding comment to this PR", "pr", pr)
 	}
 
-	// Find existing comments and update the first one if it exists
-	comments, _, err := client.Issues.ListComments(ctx, owner, repoName, prNum, nil)
+	if decision.Action != policy.ActionLight {
+		prc.CodeContext = gatherCodeContext(gitRoot, prc.ReviewDiff, paths)
+	}
+	prc.Guidelines, err = gatherGuidelines(prc, base)
 	if err != nil {
-		return fmt.Errorf("failed to list comments on PR, err: %w", err)
+		return err
 	}
 
-	const UniqueTag = "# NeuroSpecation AI Review\n"
-	reviewOutput = UniqueTag + reviewOutput
-	var commentID int64
-	for _, c := range comments {
-		if strings.Contains(*c.Body, UniqueTag) {
-			commentID = *c.ID
-			break
-		}
+	for _, file := range binaryFiles(prc.ReviewDiff) {
+		prc.Report.skip(file, "binary file")
 	}
 
-	if commentID != 0 {
-		// Update the existing comment
-		_, _, err = client.Issues.EditComment(ctx, owner, repoName, commentID, &github.IssueComment{Body: &reviewOutput})
-		if err != nil {
-			return fmt.Errorf("failed to update comment on PR, err: %w", err)
-		}
-	} else {
-		// Create a new comment if no existing comment is found
-		comment := &github.IssueComment{Body: &reviewOutput}
-		_, _, err = client.Issues.CreateComment(ctx, owner, repoName, prNum, comment)
-		if err != nil {
-			return fmt.Errorf("failed to create comment on PR, err: %w", err)
-		}
+	opts := reviewOptions{Format: format, FailOn: failOn, Personas: personas}
+	if decision.Action == policy.ActionLight {
+		// Light reviews are a single pass with the small model
+		opts.Personas = nil
 	}
+	pipelines := []prPipeline{
+		{Name: "review", Run: func(ctx context.Context) error {
+			return runReview(ctx, prc, host, canPost, aiClient, opts)
+		}},
+	}
+	if decision.Action != policy.ActionLight && canPost && pr != nil {
+		pipelines = append(pipelines, prPipeline{Name: "description", Run: func(ctx context.Context) error {
+			return runDescription(ctx, prc, host, aiClient)
+		}})
+	}
+	if decision.Action != policy.ActionLight && canPost && pr != nil && viper.GetString(triageKey) != triageOff {
+		pipelines = append(pipelines, prPipeline{Name: "triage", Run: func(ctx context.Context) error {
+			return runTriage(ctx, prc, host, aiClient)
+		}})
+	}
+	err = runPipelines(ctx, pipelines)
+	for _, w := range paths.Withheld() {
+		prc.Report.skip(w.Path, "withheld by the path policy ("+w.Rule+")")
+	}
+	if reportErr := writeRunReport(prc, prc.Report, aiClient, err); reportErr != nil {
+		slog.Warn("Could not write the job summary", "err", reportErr)
+	}
+	return err
+}
 
-	if descriptionOutput != "" {
-		pr := &github.PullRequest{
-			Body: github.Ptr(descriptionOutput),
+// errFindingsAtThreshold is returned when the review has findings at or above the --fail-on severity.
+var errFindingsAtThreshold = errors.New("findings at or above the --fail-on severity")
+
+// onlyFindingsAtThreshold reports whether err is errFindingsAtThreshold with no other error joined to it, a failed
+// description, triage or review pass must not be reported as findings.
+func onlyFindingsAtThreshold(err error) bool {
+	if !errors.Is(err, errFindingsAtThreshold) {
+		return false
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			if !onlyFindingsAtThreshold(e) {
+				return false
+			}
 		}
-		_, _, err = client.PullRequests.Edit(ctx, owner, repoName, prNum, pr)
-		if err != nil {
-			return fmt.Errorf("failed to create PR description, err: %w", err)
+		return true
+	}
+	if err == errFindingsAtThreshold {
+		return true
+	}
+	return onlyFindingsAtThreshold(errors.Unwrap(err))
+}
+
+// getDiffRange picks the revisions to diff. The exact base and head SHAs of the pull request are used when known,
+// otherwise the target branch is resolved from flags, GITHUB_BASE_REF or the default branch of origin.
+func getDiffRange(dir string, pr *codehost.PRInfo) (string, string, error) {
+	if pr != nil && pr.BaseSHA != "" {
+		head := pr.HeadSHA
+		if head == "" {
+			head = "HEAD"
 		}
+		slog.Debug("using pull request SHAs for diff", "base", pr.BaseSHA, "head", head)
+		return pr.BaseSHA, head, nil
+	}
 
+	targetBranch := viper.GetString(targetBranchKey)
+	if targetBranch == "" {
+		slog.Debug("no target branch flag set")
+		targetBranch = os.Getenv("GITHUB_BASE_REF")
+		if targetBranch == "" {
+			slog.Debug("no target branch github env set (GITHUB_BASE_REF)")
+			defaultBranchName, err := getDefaultBranch(dir)
+			if err != nil {
+				return "", "", err
+			}
+			targetBranch = defaultBranchName
+		} else {
+			slog.Debug("target branch github env set (GITHUB_BASE_REF)", "env", targetBranch)
+		}
 	}
-	return nil
+	return "origin/" + targetBranch, "HEAD", nil
 }
 
 func runGitCommand(dir string, args ...string) *exec.Cmd {
@@ -294,11 +496,39 @@ func isInsideGitRepo(dir string) bool {
 	return true
 }
 
-func getGitDiff(dir string, target string) (string, error) {
-	cmd := runGitCommand(dir, "diff", "origin/"+target+"...HEAD")
+func getGitRev(dir, rev string) (string, error) {
+	cmd := runGitCommand(dir, "rev-parse", rev)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", rev, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func getGitFileAtRev(dir, rev, path string) (string, error) {
+	cmd := runGitCommand(dir, "show", rev+":"+path)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s at %s: %w", path, rev, err)
+	}
+	return string(output), nil
+}
+
+// listGitFilesAtRev lists the files of the repository at rev, relative to its root.
+func listGitFilesAtRev(dir, rev string) ([]string, error) {
+	cmd := runGitCommand(dir, "ls-tree", "-r", "-z", "--name-only", rev)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files at %s: %w", rev, err)
+	}
+	return strings.FieldsFunc(string(output), func(r rune) bool { return r == 0 }), nil
+}
+
+func getGitDiff(dir string, base, head string) (string, error) {
+	cmd := runGitCommand(dir, "diff", base+"..."+head)
 	diffOutput, err := cmd.Output()
 	if err != nil {
-		return "", fmt.Errorf("failed to get diff between current commit and target: %s err: %w", target, err)
+		return "", fmt.Errorf("failed to get diff between %s and target: %s err: %w", head, base, err)
 	}
 	return string(diffOutput), nil
 }
@@ -335,79 +565,63 @@ func debug(dir string) {
 	}
 }
 
-func createReviewPrompt(ctx context.Context, gitRoot, diffOutput string) (string, error) {
-	reviewPrompt := ReviewPrompt
-	if os.Getenv("GITHUB_TOKEN") != "" {
-		title, body, err := getPRInfo(ctx)
-		if err != nil {
-			return "", err
-		}
-		reviewPrompt = reviewPrompt + "<PR Details>\n" + "Title: " + title + "\nBody: " + body + "\n</PR Details>\n"
+// gatherCodeContext collects the Go code around the changes within --context-budget. It is best effort,
+// failures are logged and leave the review without the extra context.
+func gatherCodeContext(gitRoot, diffOutput string, paths *pathpolicy.Policy) string {
+	budget := viper.GetInt(contextBudgetKey)
+	if budget <= 0 {
+		return ""
+	}
+	codeContext, err := codecontext.Gather(gitRoot, diffOutput, codecontext.Options{
+		Budget:        budget,
+		MaxReferences: maxContextReferences,
+		Withholds:     func(path string) bool { return paths.Withholds(path, "code context") },
+	})
+	if err != nil {
+		slog.Warn("Could not gather the code context", "err", err)
+		return ""
 	}
+	slog.Debug("Gathered code context", "snippets", len(codeContext.Snippets), "omitted", codeContext.Omitted)
+	return codeContext.String()
+}
+
+// gatherKnowledge concatenates the ai_knowledge.yaml files of the directories touched by the diff, and of any extra files.
+// Files the path policy withholds are left out.
+func gatherKnowledge(gitRoot, diffOutput string, paths *pathpolicy.Policy, extraFiles ...string) string {
+	files := append(diffFiles(diffOutput), extraFiles...)
 
-	changedFiles := strings.Split(diffOutput, "\n")
+	seen := map[string]bool{}
 	knowledgeContent := ""
-	for _, line := range changedFiles {
+	for _, filePath := range files {
+		dirPath := filepath.Dir(filepath.Join(gitRoot, filePath))
+		if seen[dirPath] {
+			continue
+		}
+		seen[dirPath] = true
+		knowledgePath := filepath.Join(dirPath, "ai_knowledge.yaml")
+		if paths.WithholdsFile(knowledgePath, "repository context") {
+			continue
+		}
+		content, err := os.ReadFile(knowledgePath)
+		if err == nil {
+			knowledgeContent += string(content) + "\n"
+		}
+	}
+	return knowledgeContent
+}
+
+// diffFiles lists the files changed in a git diff, by their path before the change.
+func diffFiles(diffOutput string) []string {
+	var files []string
+	for _, line := range strings.Split(diffOutput, "\n") {
 		if strings.HasPrefix(line, "diff --git") {
 			parts := strings.Split(line, " ")
 			if len(parts) > 2 {
-				filePath := strings.TrimPrefix(parts[2], "a/")
-				fullPath := filepath.Join(gitRoot, filePath)
-				dirPath := filepath.Dir(fullPath)
-				knowledgePath := filepath.Join(dirPath, "ai_knowledge.yaml")
-				content, err := os.ReadFile(knowledgePath)
-				if err == nil {
-					knowledgeContent += string(content) + "\n"
-				}
+				files = append(files, strings.TrimPrefix(parts[2], "a/"))
 			}
 		}
 	}
-	reviewPrompt = reviewPrompt + "\n<Repo Context>\n" + knowledgeContent + "\n</Repo Context>\n" + "\n<Diff>\n" + diffOutput + "\n</Diff>\n"
-	return reviewPrompt, nil
-}
-
-func getPRInfo(ctx context.Context) (string, string, error) {
-	if os.Getenv("GITHUB_TOKEN") == "" {
-		return "", "", nil
-	}
-
-	client := github.NewClient(nil).WithAuthToken(os.Getenv("GITHUB_TOKEN"))
-
-	repo := os.Getenv("GITHUB_REPOSITORY")
-	prNumber := os.Getenv("GITHUB_PR_NUMBER")
-
-	if repo == "" {
-		return "", "", fmt.Errorf("GITHUB_REPOSITORY environment variable is not set")
-	}
-	if prNumber == "" {
-		return "", "", fmt.Errorf("GITHUB_PR_NUMBER environment variable is not set")
-	}
-
-	ownerRepo := strings.Split(repo, "/")
-	if len(ownerRepo) != 2 {
-		return "", "", fmt.Errorf("invalid GITHUB_REPOSITORY format, got %s", repo)
-	}
-
-	owner, repoName := ownerRepo[0], ownerRepo[1]
-	prNum, err := strconv.Atoi(prNumber)
-	if err != nil {
-		return "", "", fmt.Errorf("invalid GITHUB_PR_NUMBER format, got %s: err: %w", prNumber, err)
-	}
-
-	pr, _, err := client.PullRequests.Get(ctx, owner, repoName, prNum)
-	if err != nil {
-		return "", "", fmt.Errorf("unable to get pr. err: %w", err)
-	}
-
-	if pr == nil {
-		return "", "", fmt.Errorf("expected pr data to be not nil")
-	}
-
-	if pr.Title == nil && pr.Body == nil {
-		return "", "", fmt.Errorf("expected pr title & body to be not nil")
-	}
-
-	return pr.GetTitle(), pr.GetBody(), nil
+	return files
 }
 
 func writeReviewFile(dir, reviewOutput string, dryRun bool) error {
@@ -431,3 +645,22 @@ func writeReviewFile(dir, reviewOutput string, dryRun bool) error {
 	}
 	return nil
 }
+
+func writeSARIFFile(dir string, findings []review.Finding, dryRun bool) error {
+	sarifFilePath := filepath.Join(dir, "ai_Review.sarif")
+	if dryRun {
+		slog.Debug("skipping SARIF output, would have written file to:", "path", sarifFilePath)
+		return nil
+	}
+
+	sarif, err := review.ToSARIF(findings, version)
+	if err != nil {
+		return fmt.Errorf("failed to convert findings to SARIF: %w", err)
+	}
+	if err := os.WriteFile(sarifFilePath, sarif, 0644); err != nil {
+		slog.Error("failed to write SARIF file", "err", err)
+		return err
+	}
+	slog.Info("Wrote SARIF findings", "path", sarifFilePath, "findings", len(findings))
+	return nil
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/LarsOL/NeuroSpecation/aihelpers"
+	"github.com/LarsOL/NeuroSpecation/prompts"
+	"github.com/LarsOL/NeuroSpecation/review"
+	"github.com/spf13/viper"
+	"log/slog"
+	"strings"
+)
+
+const PRSummaryPrompt = "You are a seasoned senior staff software engineer. The author of the pull request in the user message has written a description, which will be kept as it is. Your task is to write a short summary section to go below it, in Markdown format, starting with a `### AI Summary` heading. Summarise the key changes and their impact in a few bullet points, and point out anything important the author's description does not mention. Do not repeat the author's description.\n\nYou will be provided with the pull request title and description, repository context, and the Git diff of the changes.\n"
+
+// prTemplatePaths are the locations code hosts read the default pull request template from, in order of preference.
+var prTemplatePaths = []string{
+	".github/pull_request_template.md",
+	".github/PULL_REQUEST_TEMPLATE.md",
+	"pull_request_template.md",
+	"PULL_REQUEST_TEMPLATE.md",
+	"docs/pull_request_template.md",
+	"docs/PULL_REQUEST_TEMPLATE.md",
+	".gitea/pull_request_template.md",
+	".gitlab/merge_request_templates/Default.md",
+}
+
+// readPRTemplate reads the repository's pull request template at rev. The template's headings end up in the prompt, so
+// it is read from the base branch rather than the pull request's own checkout.
+func readPRTemplate(dir, rev string) string {
+	for _, p := range prTemplatePaths {
+		content, err := getGitFileAtRev(dir, rev, p)
+		if err == nil {
+			slog.Debug("found pull request template", "path", p, "rev", rev)
+			return content
+		}
+	}
+	return ""
+}
+
+// describePullRequest returns the new pull request description, or "" when it should be left unchanged.
+// What the author wrote is kept: an empty description is written in full, unfilled sections of the repository's
+// pull request template are filled in, otherwise an AI summary section between markers is added or updated.
+func describePullRequest(ctx context.Context, aiClient *aihelpers.AIClient, prc *prContext) (string, error) {
+	pr := prc.PR
+	template := prc.PRTemplate
+	body := pr.Body
+	authorWritten := strings.TrimSpace(review.WithoutSummary(body)) != ""
+	if !authorWritten && template != "" {
+		// Start from the template rather than the summary section, so the author can edit the sections later
+		body = template
+	}
+	unfilled := review.UnfilledSections(body, template)
+
+	var prompt *guardedPrompt
+	var err error
+	switch {
+	case len(unfilled) > 0:
+		prompt, err = prc.templatePrompt(prompts.Description, prc.Diff)
+		if err != nil {
+			return "", err
+		}
+		prompt.instruct("The repository uses the pull request template given as data. Write the description using its headings, filling in the sections listed as data.")
+		prompt.data("pull request template", template)
+		prompt.data("sections to fill in", strings.Join(unfilled, "\n"))
+	case authorWritten:
+		prompt = prc.prompt(PRSummaryPrompt, prc.Diff)
+	default:
+		prompt, err = prc.templatePrompt(prompts.Description, prc.Diff)
+		if err != nil {
+			return "", err
+		}
+	}
+	prompt.expectOutput(600)
+	if viper.GetBool(logPromptKey) {
+		if err := logPromptToFile(prc.Dir, "ai_description_prompt.txt", prompt.String()); err != nil {
+			return "", err
+		}
+	}
+
+	ans, err := promptAI(ctx, aiClient, prompt, viper.GetBool(dryRunKey))
+	if err != nil {
+		return "", err
+	}
+	if viper.GetBool(dryRunKey) {
+		slog.Debug("Dry-run mode, skipping PR description")
+		return "", nil
+	}
+	generated, err := extractBlock(ans, "markdown")
+	if err != nil {
+		return "", fmt.Errorf("expected PR description output to contain a markdown block: %w", err)
+	}
+
+	description := review.UpsertSummary(body, generated)
+	if len(unfilled) > 0 {
+		slog.Info("Filling in pull request template sections", "sections", unfilled)
+		description = review.FillSections(body, generated, unfilled)
+	}
+	if description == pr.Body {
+		return "", nil
+	}
+	return description, nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/LarsOL/NeuroSpecation/guidelines"
+	"github.com/LarsOL/NeuroSpecation/review"
+	"github.com/spf13/viper"
+	"log/slog"
+)
+
+// gatherGuidelines collects the rules covering the reviewed files and the guideline documents that fit in
+// --guidelines-budget. The repository's guidelines are read at rev, so a pull request cannot loosen the rules it is
+// reviewed against.
+func gatherGuidelines(prc *prContext, rev string) (guidelines.Guidelines, error) {
+	cfg := guidelines.Config{Sources: viper.GetStringSlice(guidelinesKey)}
+	if err := viper.UnmarshalKey(rulesKey, &cfg.Rules); err != nil {
+		return guidelines.Guidelines{}, fmt.Errorf("failed to parse the %s setting: %w", rulesKey, err)
+	}
+	if content, err := getGitFileAtRev(prc.Dir, rev, guidelines.FileName); err == nil {
+		repo, err := guidelines.Parse([]byte(content))
+		if err != nil {
+			return guidelines.Guidelines{}, fmt.Errorf("%s at %s: %w", guidelines.FileName, rev, err)
+		}
+		cfg = cfg.Merge(repo)
+	} else {
+		slog.Debug("No guidelines file", "path", guidelines.FileName, "rev", rev, "err", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return guidelines.Guidelines{}, fmt.Errorf("invalid guidelines: %w", err)
+	}
+
+	g := guidelines.Guidelines{Rules: cfg.RulesFor(diffFiles(prc.ReviewDiff))}
+	if len(cfg.Sources) > 0 {
+		files, err := listGitFilesAtRev(prc.Dir, rev)
+		if err != nil {
+			return g, err
+		}
+		budget := viper.GetInt(guidelinesBudgetKey)
+		for _, file := range files {
+			if !cfg.IsSource(file) || prc.Paths.Withholds(file, "guidelines") {
+				continue
+			}
+			content, err := getGitFileAtRev(prc.Dir, rev, file)
+			if err != nil {
+				return g, err
+			}
+			if !g.Add(guidelines.Document{Path: file, Content: content}, budget) {
+				slog.Warn("Guideline document does not fit in --"+guidelinesBudgetKey+", leaving it out", "path", file, "budget", budget)
+			}
+		}
+	}
+	slog.Info("Review guidelines", "rules", len(g.Rules), "documents", len(g.Documents))
+	return g, nil
+}
+
+// addGuidelines asks the review to enforce the repository's guidelines, if it has any.
+func (c *prContext) addGuidelines(p *guardedPrompt) {
+	if c.Guidelines.Empty() {
+		return
+	}
+	p.instruct(review.GuidelinesInstructions)
+	if len(c.Guidelines.Rules) > 0 {
+		p.data("repository rules", c.Guidelines.RulesText())
+	}
+	if len(c.Guidelines.Documents) > 0 {
+		p.data("guideline documents", c.Guidelines.DocumentsText())
+	}
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/LarsOL/NeuroSpecation/codehost"
+	"github.com/spf13/viper"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// newCodeHost returns the code host selected by --host, or detected from the CI environment.
+// canPost reports whether a token is available to write the review to the host.
+func newCodeHost(ctx context.Context) (codehost.Host, bool, error) {
+	kind := viper.GetString(hostKey)
+	if kind == "" {
+		kind = "github"
+		if os.Getenv("GITLAB_CI") != "" {
+			kind = "gitlab"
+		}
+	}
+	slog.Debug("using code host", "host", kind)
+
+	switch kind {
+	case "github":
+		gh, err := codehost.NewGitHubFromEnv()
+		if err != nil {
+			return nil, false, err
+		}
+		auth, err := gitHubAuth()
+		if err != nil {
+			return nil, false, err
+		}
+		if auth.BaseURL != "" || auth.App != nil || auth.Token != gh.Token {
+			gh.Client, gh.Token, gh.Login, err = codehost.NewGitHubClient(ctx, auth, gh.Owner, gh.Repo)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		if n := viper.GetInt(prNumberKey); n != 0 {
+			gh.PRNumber = n
+		}
+		return gh, gh.Token != "", nil
+	case "gitlab":
+		gl, err := codehost.NewGitLabFromEnv()
+		if err != nil {
+			return nil, false, err
+		}
+		if u := hostURLFlag(); u != "" {
+			gl.BaseURL = u + "/api/v4"
+		}
+		if token := viper.GetString(hostTokenKey); token != "" {
+			gl.Token = token
+		}
+		if repo := viper.GetString(repoKey); repo != "" {
+			gl.ProjectID = repo
+		}
+		if n := viper.GetInt(prNumberKey); n != 0 {
+			gl.MRIID = n
+		}
+		return gl, gl.Token != "", nil
+	case "gitea":
+		g := &codehost.Gitea{
+			BaseURL:   hostURLFlag(),
+			Token:     hostToken("GITEA_TOKEN"),
+			PRNumber:  viper.GetInt(prNumberKey),
+			EventName: os.Getenv("GITHUB_EVENT_NAME"),
+			EventPath: os.Getenv("GITHUB_EVENT_PATH"),
+		}
+		if g.BaseURL == "" {
+			// Gitea and Forgejo Actions expose the server URL with the GitHub variable names
+			g.BaseURL = strings.TrimSuffix(os.Getenv("GITHUB_SERVER_URL"), "/")
+		}
+		owner, repo, err := splitRepo(os.Getenv("GITHUB_REPOSITORY"))
+		if err != nil {
+			return nil, false, err
+		}
+		g.Owner, g.Repo = owner, repo
+		return g, g.Token != "", nil
+	case "bitbucket":
+		b := &codehost.BitbucketServer{
+			BaseURL:  hostURLFlag(),
+			Token:    hostToken("BITBUCKET_TOKEN"),
+			PRNumber: viper.GetInt(prNumberKey),
+		}
+		project, repo, err := splitRepo("")
+		if err != nil {
+			return nil, false, err
+		}
+		b.Project, b.Repo = project, repo
+		return b, b.Token != "", nil
+	default:
+		return nil, false, fmt.Errorf("unknown code host %q, expected github, gitlab, gitea or bitbucket", kind)
+	}
+}
+
+// gitHubAuth resolves the GitHub endpoint and credentials from flags, falling back to the environment.
+func gitHubAuth() (codehost.GitHubAuth, error) {
+	auth := codehost.GitHubAuth{
+		BaseURL:   viper.GetString(githubAPIURLKey),
+		UploadURL: viper.GetString(githubUploadURLKey),
+		Token:     hostToken("GITHUB_TOKEN"),
+	}
+	if auth.BaseURL == "" {
+		// Actions on GitHub Enterprise Server set GITHUB_API_URL to the instance
+		if apiURL := os.Getenv("GITHUB_API_URL"); apiURL != "" && apiURL != "https://api.github.com" {
+			auth.BaseURL = apiURL
+		}
+	}
+	if auth.BaseURL == "" {
+		auth.BaseURL = hostURLFlag()
+	}
+
+	appID := viper.GetInt64(githubAppIDKey)
+	if appID == 0 {
+		if id := os.Getenv("GITHUB_APP_ID"); id != "" {
+			var err error
+			appID, err = strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				return auth, fmt.Errorf("invalid GITHUB_APP_ID format, got %s: err: %w", id, err)
+			}
+		}
+	}
+	if appID == 0 {
+		return auth, nil
+	}
+
+	installationID := viper.GetInt64(githubAppInstallationIDKey)
+	if installationID == 0 {
+		if id := os.Getenv("GITHUB_APP_INSTALLATION_ID"); id != "" {
+			var err error
+			installationID, err = strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				return auth, fmt.Errorf("invalid GITHUB_APP_INSTALLATION_ID format, got %s: err: %w", id, err)
+			}
+		}
+	}
+
+	privateKey := []byte(os.Getenv("GITHUB_APP_PRIVATE_KEY"))
+	if keyFile := viper.GetString(githubAppPrivateKeyKey); keyFile != "" {
+		var err error
+		privateKey, err = os.ReadFile(keyFile)
+		if err != nil {
+			return auth, fmt.Errorf("failed to read GitHub App private key: %w", err)
+		}
+	}
+	if len(privateKey) == 0 {
+		return auth, fmt.Errorf("GitHub App ID is set but no private key was provided")
+	}
+
+	slog.Debug("authenticating as GitHub App", "appID", appID, "installationID", installationID)
+	auth.App = &codehost.GitHubApp{
+		AppID:          appID,
+		InstallationID: installationID,
+		PrivateKey:     privateKey,
+	}
+	return auth, nil
+}
+
+func hostURLFlag() string {
+	return strings.TrimSuffix(viper.GetString(hostURLKey), "/")
+}
+
+// hostToken returns the --host-token flag, falling back to the given environment variable.
+func hostToken(envKey string) string {
+	if token := viper.GetString(hostTokenKey); token != "" {
+		return token
+	}
+	return os.Getenv(envKey)
+}
+
+// splitRepo splits the --repo flag, or the fallback, into its owner (or project) and name.
+func splitRepo(fallback string) (string, string, error) {
+	repo := viper.GetString(repoKey)
+	if repo == "" {
+		repo = fallback
+	}
+	if repo == "" {
+		return "", "", nil
+	}
+	ownerRepo := strings.Split(repo, "/")
+	if len(ownerRepo) != 2 {
+		return "", "", fmt.Errorf("invalid repository format, expected owner/repo, got %s", repo)
+	}
+	return ownerRepo[0], ownerRepo[1], nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/LarsOL/NeuroSpecation/codehost"
+	"github.com/LarsOL/NeuroSpecation/review"
+	"github.com/spf13/viper"
+	"log/slog"
+	"strings"
+)
+
+// priorReview is the earlier review comment that an incremental review is appended to.
+type priorReview struct {
+	Comment string
+	// SHA is the head commit the earlier review covered
+	SHA string
+}
+
+// findPriorReview returns the earlier review to build on, or nil when the whole pull request should be reviewed:
+// when forced, when the review gates the merge, when there is no earlier review, when nothing was pushed since, or
+// when the history was rewritten.
+func findPriorReview(ctx context.Context, host codehost.Host, pr *codehost.PRInfo, dir string, force bool) (*priorReview, error) {
+	if force {
+		slog.Info("Full review requested")
+		return nil, nil
+	}
+	if viper.GetString(publishKey) != publishComment || viper.GetString(failOnKey) != "" {
+		// The check run and --fail-on gate the merge, so they must judge the whole pull request and not only the
+		// latest commits. In check mode there is also no review comment recording the reviewed commit.
+		slog.Info("Reviewing the whole pull request, a check run or --" + failOnKey + " is configured")
+		return nil, nil
+	}
+
+	comment, err := host.FindComment(ctx, pr, reviewCommentTag)
+	if err != nil {
+		return nil, err
+	}
+	sha := review.ReviewedSHA(comment)
+	switch {
+	case sha == "":
+		return nil, nil
+	case sha == pr.HeadSHA:
+		slog.Info("No new commits since the last review, reviewing the whole pull request", "sha", sha)
+		return nil, nil
+	case !isGitAncestor(dir, sha, pr.HeadSHA):
+		slog.Info("Last reviewed commit is not part of the branch anymore, reviewing the whole pull request", "sha", sha)
+		return nil, nil
+	}
+	slog.Info("Reviewing the commits since the last review", "since", sha, "head", pr.HeadSHA)
+	return &priorReview{Comment: comment, SHA: sha}, nil
+}
+
+// isGitAncestor reports whether rev is an ancestor of head, it is false when rev is unknown, e.g. after a force push.
+func isGitAncestor(dir, rev, head string) bool {
+	return runGitCommand(dir, "merge-base", "--is-ancestor", rev, head).Run() == nil
+}
+
+// getInterdiff returns the changes from since to head, limited to the files the pull request touches
+// so that changes merged in from the target branch are not reviewed again.
+func getInterdiff(dir, base, since, head string) (string, error) {
+	output, err := runGitCommand(dir, "diff", "--name-only", "-z", base+"..."+head).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to list changed files between %s and %s: %w", base, head, err)
+	}
+	files := strings.FieldsFunc(string(output), func(r rune) bool { return r == 0 })
+	if len(files) == 0 {
+		return "", nil
+	}
+
+	args := append([]string{"diff", since, head, "--"}, files...)
+	diffOutput, err := runGitCommand(dir, args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get diff between %s and %s: %w", since, head, err)
+	}
+	return string(diffOutput), nil
+}
+
+// reviewComment renders the review comment body, appending to the earlier review when the review is incremental.
+func reviewComment(pr *codehost.PRInfo, reviewText string, prior *priorReview) string {
+	if prior != nil {
+		body := review.AppendIncremental(prior.Comment, reviewText, prior.SHA, pr.HeadSHA)
+		if len(body) <= maxCommentLength {
+			return body
+		}
+		slog.Warn("Review comment is too long to keep the earlier reviews, replacing them", "length", len(body))
+	}
+	return review.WithReviewedSHA(reviewCommentTag+reviewText, pr.HeadSHA)
+}
+
+// maxCommentLength is the longest comment GitHub accepts.
+const maxCommentLength = 65536
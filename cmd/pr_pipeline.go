@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/LarsOL/NeuroSpecation/aihelpers"
+	"github.com/LarsOL/NeuroSpecation/codehost"
+	"github.com/LarsOL/NeuroSpecation/guidelines"
+	"github.com/LarsOL/NeuroSpecation/pathpolicy"
+	"github.com/LarsOL/NeuroSpecation/promptguard"
+	"github.com/LarsOL/NeuroSpecation/prompts"
+	"github.com/LarsOL/NeuroSpecation/review"
+	"github.com/spf13/viper"
+	"sync"
+)
+
+// prContext is gathered once per run and shared by all pipelines.
+type prContext struct {
+	Dir     string
+	GitRoot string
+	// PR is nil when not running against a pull request
+	PR *codehost.PRInfo
+	// Diff covers the whole pull request
+	Diff string
+	// Knowledge holds the ai_knowledge.yaml files of the directories the diff touches
+	Knowledge string
+	// Prior is the earlier review when only the commits since then are reviewed
+	Prior *priorReview
+	// ReviewDiff is the part of the pull request to review, the commits since the prior review or the whole diff
+	ReviewDiff string
+	// CodeContext holds the Go declarations around the changes and the code referencing changed symbols
+	CodeContext string
+	// Report collects the outcome of the pipelines
+	Report *runReport
+	// Paths is the path policy the diff was filtered with, nil if the repository has none
+	Paths *pathpolicy.Policy
+	// Prompts are the prompt templates, as of the base branch
+	Prompts prompts.Set
+	// Guidelines are the rules and documents the review enforces, as of the base branch
+	Guidelines guidelines.Guidelines
+	// PRTemplate is the repository's pull request template, as of the base branch, "" if it has none
+	PRTemplate string
+}
+
+// prompt builds a prompt from the task instructions and the pull request details, context and diff.
+func (c *prContext) prompt(instructions, diff string) *guardedPrompt {
+	p := newGuardedPrompt(instructions)
+	if c.PR != nil {
+		p.data("pull request details", "Title: "+c.PR.Title+"\nBody: "+c.PR.Body)
+	}
+	p.data("repository context", c.Knowledge)
+	p.data("diff", diff)
+	return p
+}
+
+// templatePrompt renders the named prompt template with the pull request details, context and diff.
+func (c *prContext) templatePrompt(name, diff string) (*guardedPrompt, error) {
+	data := prompts.Data{Diff: diff, Knowledge: c.Knowledge, CodeContext: c.CodeContext}
+	if c.PR != nil {
+		data.PR = &prompts.PR{Number: c.PR.Number, Title: c.PR.Title, Body: c.PR.Body, Author: c.PR.Author, Labels: c.PR.Labels}
+	}
+	return newTemplatedPrompt(c.Prompts[name], data)
+}
+
+// addCodeContext adds the gathered code context to the prompt, if there is any.
+func (c *prContext) addCodeContext(p *guardedPrompt) {
+	if c.CodeContext != "" {
+		p.data("code context: the full declarations around the changes and code using the changed symbols, as they are after the change", c.CodeContext)
+	}
+}
+
+// prPipeline is an independent task run against a pull request, e.g. the review or the description.
+type prPipeline struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// runPipelines runs the pipelines concurrently. A failing pipeline does not stop the others,
+// each failure is reported on its own and all of them are returned.
+func runPipelines(ctx context.Context, pipelines []prPipeline) error {
+	errs := make([]error, len(pipelines))
+	var wg sync.WaitGroup
+	for i, p := range pipelines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l := loggerFromCtx(ctx).With("pipeline", p.Name)
+			if err := p.Run(setLoggerToCtx(ctx, l)); err != nil {
+				l.Error("Pipeline failed", "err", err)
+				errs[i] = fmt.Errorf("%s: %w", p.Name, err)
+				return
+			}
+			l.Info("Pipeline finished")
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// reviewOptions are the review settings validated before any work is done.
+type reviewOptions struct {
+	Format string
+	FailOn review.Severity
+	// Personas split the review into a pass per persona, a single general review is run if empty
+	Personas []review.Persona
+}
+
+func runReview(ctx context.Context, prc *prContext, host codehost.Host, canPost bool, aiClient *aihelpers.AIClient, opts reviewOptions) error {
+	var results []reviewResult
+	if len(opts.Personas) == 0 {
+		results = []reviewResult{reviewPass(ctx, prc, aiClient, nil, opts)}
+	} else {
+		results = runReviewPasses(ctx, prc, aiClient, opts)
+	}
+	combined, failed := aggregateReviews(results)
+	if failed == len(results) {
+		return combined.Err
+	}
+
+	reviewText, findings := combined.Text, combined.Findings
+	if combined.Parsed {
+		summary := review.SummaryTable(findings)
+		fmt.Print(summary)
+		reviewText = reviewText + "\n\n" + summary
+	}
+
+	if warnings := injectionWarnings(prc); len(warnings) > 0 {
+		loggerFromCtx(ctx).Warn("Possible prompt injection in the pull request", "count", len(warnings))
+		reviewText = promptguard.Summary(warnings) + "\n" + reviewText
+	}
+
+	if opts.Format == formatSARIF {
+		if err := writeSARIFFile(prc.Dir, findings, viper.GetBool(dryRunKey)); err != nil {
+			return err
+		}
+	}
+
+	if viper.GetBool(dryRunKey) && canPost && prc.PR != nil {
+		// Nothing was reviewed, a published review would mark the head as reviewed and could pass the check
+		loggerFromCtx(ctx).Info("Dry-run mode, not publishing the review", "pr", prc.PR.Number)
+	}
+	if !canPost || prc.PR == nil || viper.GetBool(dryRunKey) {
+		prc.Report.recordReview(findings, "", "")
+		if opts.Format != formatSARIF {
+			err := writeReviewFile(prc.Dir, reviewText, viper.GetBool(dryRunKey))
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		suggestions := suggestionComments(prc.Dir, prc.PR.HeadSHA, prc.ReviewDiff, findings)
+		commentURL, checkURL, err := writeReviewToPR(ctx, host, prc.PR, reviewText, findings, suggestions, prc.Prior)
+		prc.Report.recordReview(findings, commentURL, checkURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.FailOn != "" {
+		if n := review.CountAtOrAbove(findings, opts.FailOn); n > 0 {
+			return errors.Join(combined.Err, fmt.Errorf("%w: %d findings at or above %s", errFindingsAtThreshold, n, opts.FailOn))
+		}
+	}
+	// Failed passes fail the run, after the passes that succeeded are published
+	return combined.Err
+}
+
+// injectionWarnings flags text in the reviewed changes and the pull request that reads like instructions to the model.
+func injectionWarnings(prc *prContext) []promptguard.Warning {
+	var warnings []promptguard.Warning
+	if prc.PR != nil {
+		warnings = append(warnings, promptguard.Detect("pull request title", prc.PR.Title)...)
+		warnings = append(warnings, promptguard.Detect("pull request description", prc.PR.Body)...)
+	}
+	return append(warnings, promptguard.DetectDiff(prc.ReviewDiff)...)
+}
+
+func runDescription(ctx context.Context, prc *prContext, host codehost.Host, aiClient *aihelpers.AIClient) error {
+	description, err := describePullRequest(ctx, aiClient, prc)
+	if err != nil {
+		return err
+	}
+	if description == "" {
+		loggerFromCtx(ctx).Info("PR description is up to date")
+		return nil
+	}
+	if err := host.UpdateDescription(ctx, prc.PR, description); err != nil {
+		return fmt.Errorf("failed to update PR description, err: %w", err)
+	}
+	loggerFromCtx(ctx).Info("Updated PR description")
+	return nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/LarsOL/NeuroSpecation/aihelpers"
+	"github.com/LarsOL/NeuroSpecation/codehost"
+	"github.com/LarsOL/NeuroSpecation/policy"
+	"github.com/spf13/viper"
+	"log/slog"
+)
+
+func reviewPolicy() policy.Config {
+	return policy.Config{
+		SkipDrafts:      viper.GetBool(skipDraftsKey),
+		SkipAuthors:     viper.GetStringSlice(skipAuthorsKey),
+		SkipLabels:      viper.GetStringSlice(skipLabelsKey),
+		MinChangedLines: viper.GetInt(minChangedLinesKey),
+		MaxChangedLines: viper.GetInt(maxChangedLinesKey),
+		MaxChangedFiles: viper.GetInt(maxChangedFilesKey),
+		LightAuthors:    viper.GetStringSlice(lightAuthorsKey),
+		LightLabels:     viper.GetStringSlice(lightLabelsKey),
+		LightMaxLines:   viper.GetInt(lightMaxLinesKey),
+	}
+}
+
+// applyReviewPolicy decides how to review the change, switches to the small model for light reviews,
+// and records the decision in the log and the job summary.
+func applyReviewPolicy(ctx context.Context, pr *codehost.PRInfo, diffOutput string, aiClient *aihelpers.AIClient) (policy.Decision, error) {
+	var change policy.Change
+	if pr != nil {
+		change = policy.Change{Author: pr.Author, Draft: pr.Draft, Labels: pr.Labels}
+	}
+	change.Lines, change.Files = policy.DiffStats(diffOutput)
+	decision := policy.Decide(reviewPolicy(), change)
+
+	model := viper.GetString(modelKey)
+	if decision.Action == policy.ActionLight && viper.GetString(smallModelKey) != "" {
+		model = viper.GetString(smallModelKey)
+		if aiClient != nil {
+			aiClient.SetModel(model)
+		}
+		estimateFromCtx(ctx).setModel(model)
+	}
+	if decision.Action == policy.ActionSkip {
+		model = "none"
+	}
+
+	slog.Info("Review policy decision", "action", decision.Action, "reason", decision.Reason, "lines", change.Lines, "files", change.Files, "model", model)
+	summary := fmt.Sprintf("### NeuroSpecation review policy\n\n| Decision | Reason | Changed | Model |\n| --- | --- | --- | --- |\n| %s | %s | %d lines in %d files | %s |\n",
+		decision.Action, decision.Reason, change.Lines, change.Files, model)
+	if err := appendJobSummary(summary); err != nil {
+		return decision, err
+	}
+	return decision, setStepOutputs(map[string]string{"decision": string(decision.Action)})
+}
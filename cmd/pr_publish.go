@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/LarsOL/NeuroSpecation/codehost"
+	"github.com/LarsOL/NeuroSpecation/review"
+	"github.com/spf13/viper"
+	"log/slog"
+)
+
+const (
+	publishComment = "comment"
+	publishCheck   = "check"
+	publishBoth    = "both"
+)
+
+// reviewCommentTag identifies the review comment, it is updated in place on later runs.
+const reviewCommentTag = "# NeuroSpecation AI Review\n"
+
+// checkRunName is the name the review is reported under, branch protection rules refer to it.
+const checkRunName = "NeuroSpecation"
+
+// writeReviewToPR publishes the review and returns the URLs of the review comment and check run, if posted.
+func writeReviewToPR(ctx context.Context, host codehost.Host, pr *codehost.PRInfo, reviewText string, findings []review.Finding, suggestions []codehost.InlineComment, prior *priorReview) (commentURL, checkURL string, err error) {
+	if viper.GetBool(debugKey) {
+		slog.Debug("Adding review to this PR", "pr", pr)
+	}
+
+	mode := viper.GetString(publishKey)
+	switch mode {
+	case publishComment, publishCheck, publishBoth:
+	default:
+		return "", "", fmt.Errorf("unknown publish mode %q, expected comment, check or both", mode)
+	}
+
+	if mode != publishCheck {
+		commentURL, err = host.UpsertComment(ctx, pr, reviewCommentTag, reviewComment(pr, reviewText, prior))
+		if err != nil {
+			return "", "", err
+		}
+		slog.Info("Posted review", "url", commentURL)
+	}
+
+	if mode != publishComment {
+		checks, ok := host.(codehost.CheckPublisher)
+		if !ok {
+			return commentURL, "", fmt.Errorf("code host does not support check runs, use --%s %s", publishKey, publishComment)
+		}
+		checkURL, err = checks.PublishCheck(ctx, pr, findingsToCheck(reviewText, findings))
+		if err != nil {
+			return commentURL, "", err
+		}
+		slog.Info("Published check run", "url", checkURL)
+	}
+
+	if len(suggestions) > 0 {
+		if err := host.PostInlineComments(ctx, pr, suggestions); err != nil {
+			return commentURL, checkURL, err
+		}
+		slog.Info("Posted suggested changes", "count", len(suggestions))
+	}
+	return commentURL, checkURL, nil
+}
+
+// annotationLevel maps finding severities to check run annotation levels, only critical findings fail the check.
+func annotationLevel(sev review.Severity) string {
+	switch sev {
+	case review.SeverityCritical:
+		return codehost.AnnotationFailure
+	case review.SeverityHigh, review.SeverityMedium:
+		return codehost.AnnotationWarning
+	default:
+		return codehost.AnnotationNotice
+	}
+}
+
+func findingsToCheck(reviewText string, findings []review.Finding) codehost.Check {
+	check := codehost.Check{
+		Name:       checkRunName,
+		Title:      "No findings",
+		Summary:    reviewText,
+		Conclusion: "success",
+	}
+	if len(findings) == 0 {
+		return check
+	}
+
+	maxSev := review.MaxSeverity(findings)
+	check.Title = fmt.Sprintf("%d findings, highest severity: %s", len(findings), maxSev)
+	switch annotationLevel(maxSev) {
+	case codehost.AnnotationFailure:
+		check.Conclusion = "failure"
+	case codehost.AnnotationWarning:
+		check.Conclusion = "neutral"
+	}
+
+	for _, f := range findings {
+		// Findings that are not tied to lines are only part of the summary
+		if f.File == "" || f.StartLine <= 0 {
+			continue
+		}
+		check.Annotations = append(check.Annotations, codehost.Annotation{
+			Path:      f.File,
+			StartLine: f.StartLine,
+			EndLine:   f.EndLine,
+			Level:     annotationLevel(f.Severity),
+			Title:     fmt.Sprintf("[%s] %s", f.Severity, f.Title),
+			Message:   f.Details(),
+		})
+	}
+	return check
+}
+
+// suggestionComments turns the findings whose suggestion applies cleanly to the head revision into inline comments.
+func suggestionComments(dir, head, diff string, findings []review.Finding) []codehost.InlineComment {
+	diffLines := review.ParseDiffLines(diff)
+	var comments []codehost.InlineComment
+	for _, f := range findings {
+		if f.Suggestion == "" {
+			continue
+		}
+		content, err := getGitFileAtRev(dir, head, f.File)
+		if err == nil {
+			err = review.ValidateSuggestion(f, content, diffLines)
+		}
+		if err != nil {
+			slog.Info("Skipping suggestion that does not apply cleanly", "location", f.Location(), "err", err)
+			continue
+		}
+		comments = append(comments, codehost.InlineComment{
+			Path:      f.File,
+			StartLine: f.StartLine,
+			Line:      f.EndLine,
+			Body:      review.SuggestionComment(f),
+		})
+	}
+	return comments
+}
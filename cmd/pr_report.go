@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/LarsOL/NeuroSpecation/aihelpers"
+	"github.com/LarsOL/NeuroSpecation/policy"
+	"github.com/LarsOL/NeuroSpecation/review"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// runReport collects what the pipelines did, for the job summary and the step outputs.
+type runReport struct {
+	mu         sync.Mutex
+	reviewed   bool
+	findings   []review.Finding
+	commentURL string
+	checkURL   string
+	// skipped maps files that were not reviewed to the reason why
+	skipped map[string]string
+}
+
+func (r *runReport) recordReview(findings []review.Finding, commentURL, checkURL string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reviewed = true
+	r.findings = findings
+	r.commentURL = commentURL
+	r.checkURL = checkURL
+}
+
+func (r *runReport) skip(file, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.skipped == nil {
+		r.skipped = map[string]string{}
+	}
+	r.skipped[file] = reason
+}
+
+// binaryFiles lists the files a git diff only reports as "Binary files ... differ", their content is not reviewed.
+func binaryFiles(diffOutput string) []string {
+	var files []string
+	for _, line := range strings.Split(diffOutput, "\n") {
+		if !strings.HasPrefix(line, "Binary files ") || !strings.HasSuffix(line, " differ") {
+			continue
+		}
+		_, after, ok := strings.Cut(strings.TrimSuffix(line, " differ"), " and ")
+		if !ok {
+			continue
+		}
+		if after == "/dev/null" {
+			// Deleted file, use the old path
+			before, _, _ := strings.Cut(strings.TrimPrefix(line, "Binary files "), " and ")
+			after = before
+		}
+		files = append(files, strings.TrimPrefix(strings.TrimPrefix(after, "a/"), "b/"))
+	}
+	return files
+}
+
+// writeRunReport writes the job summary and step outputs once all pipelines are done.
+func writeRunReport(prc *prContext, report *runReport, aiClient *aihelpers.AIClient, pipelineErr error) error {
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString("### NeuroSpecation review\n\n")
+	if prc.PR != nil {
+		sb.WriteString(fmt.Sprintf("Pull request #%d: %s\n\n", prc.PR.Number, prc.PR.Title))
+	}
+	lines, files := policy.DiffStats(prc.ReviewDiff)
+	if prc.Prior != nil {
+		sb.WriteString(fmt.Sprintf("Reviewed %d changed lines in %d files since the last review of %s.\n\n", lines, files, prc.Prior.SHA))
+	} else {
+		sb.WriteString(fmt.Sprintf("Reviewed %d changed lines in %d files.\n\n", lines, files))
+	}
+
+	if report.reviewed {
+		sb.WriteString(review.SummaryTable(report.findings) + "\n")
+	}
+	if report.commentURL != "" {
+		sb.WriteString(fmt.Sprintf("[Review comment](%s)\n\n", report.commentURL))
+	}
+	if report.checkURL != "" {
+		sb.WriteString(fmt.Sprintf("[Check run](%s)\n\n", report.checkURL))
+	}
+
+	if aiClient != nil {
+		if usage := aiClient.Usage(); len(usage) > 0 {
+			sb.WriteString("| Model | Requests | Prompt tokens | Completion tokens | Cost |\n|---|---|---|---|---|\n")
+			for _, u := range usage {
+				cost := "unknown"
+				if c, ok := aiClient.Cost(u); ok {
+					cost = fmt.Sprintf("$%.4f", c)
+				}
+				sb.WriteString(fmt.Sprintf("| %s | %d | %d | %d | %s |\n", u.Model, u.Requests, u.PromptTokens, u.CompletionTokens, cost))
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	if len(report.skipped) > 0 {
+		sb.WriteString("Skipped files:\n")
+		for _, file := range slices.Sorted(maps.Keys(report.skipped)) {
+			sb.WriteString(fmt.Sprintf("- `%s`: %s\n", file, report.skipped[file]))
+		}
+		sb.WriteString("\n")
+	}
+
+	if pipelineErr != nil {
+		sb.WriteString("Failures:\n")
+		for _, line := range strings.Split(pipelineErr.Error(), "\n") {
+			sb.WriteString("- " + line + "\n")
+		}
+	}
+
+	if err := appendJobSummary(sb.String()); err != nil {
+		return err
+	}
+
+	outputs := map[string]string{
+		"findings":     strconv.Itoa(len(report.findings)),
+		"max-severity": string(review.MaxSeverity(report.findings)),
+		"comment-url":  report.commentURL,
+		"check-url":    report.checkURL,
+	}
+	for _, sev := range review.Severities {
+		n := 0
+		for _, f := range report.findings {
+			if f.Severity == sev {
+				n++
+			}
+		}
+		outputs[string(sev)] = strconv.Itoa(n)
+	}
+	return setStepOutputs(outputs)
+}
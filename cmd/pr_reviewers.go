@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/LarsOL/NeuroSpecation/aihelpers"
+	"github.com/LarsOL/NeuroSpecation/prompts"
+	"github.com/LarsOL/NeuroSpecation/review"
+	"github.com/spf13/viper"
+	"strings"
+	"sync"
+)
+
+// reviewPersonas resolves --reviewers against the built-in personas and the ones in the config.
+func reviewPersonas() ([]review.Persona, error) {
+	var custom map[string]review.Persona
+	if err := viper.UnmarshalKey(personasKey, &custom); err != nil {
+		return nil, fmt.Errorf("failed to parse the %s setting: %w", personasKey, err)
+	}
+	// Keys are case-insensitive, as in the rest of the configuration
+	for name, p := range custom {
+		delete(custom, name)
+		custom[strings.ToLower(name)] = p
+	}
+	return review.ResolvePersonas(viper.GetStringSlice(reviewersKey), custom)
+}
+
+// reviewResult is the outcome of one review pass.
+type reviewResult struct {
+	// Persona is empty for the general review
+	Persona  string
+	Text     string
+	Findings []review.Finding
+	// Parsed is whether the findings could be parsed from the answer
+	Parsed bool
+	Err    error
+}
+
+// reviewPass reviews the change, as the persona if it is not nil.
+func reviewPass(ctx context.Context, prc *prContext, aiClient *aihelpers.AIClient, persona *review.Persona, opts reviewOptions) reviewResult {
+	var result reviewResult
+	prompt, err := prc.templatePrompt(prompts.Review, prc.ReviewDiff)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	// The findings are parsed from the answer, so their format cannot be overridden
+	prompt.instruct(review.FindingsInstructions)
+	prc.addGuidelines(prompt)
+	if prc.Prior != nil {
+		prompt.instruct("The pull request was already reviewed up to commit " + prc.Prior.SHA + ". The diff only contains the changes pushed since then, focus the review on them.")
+	}
+	logFile := "ai_review_prompt.txt"
+	if persona != nil {
+		result.Persona = persona.Name
+		prompt.instruct(persona.Instructions())
+		prompt.useModel(persona.Model)
+		logFile = "ai_review_prompt_" + persona.Name + ".txt"
+	}
+
+	if viper.GetBool(logPromptKey) {
+		if err := logPromptToFile(prc.Dir, logFile, prompt.String()); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	output, err := promptAI(ctx, aiClient, prompt, viper.GetBool(dryRunKey))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Text, result.Findings, err = review.ParseFindings(output)
+	if err != nil {
+		if !viper.GetBool(dryRunKey) {
+			loggerFromCtx(ctx).Warn("Could not parse structured findings from the review", "err", err)
+		}
+		if opts.FailOn != "" && !viper.GetBool(dryRunKey) {
+			result.Err = fmt.Errorf("--%s requires structured findings: %w", failOnKey, err)
+		}
+		return result
+	}
+	result.Parsed = true
+	return result
+}
+
+// runReviewPasses runs a review pass per persona concurrently.
+func runReviewPasses(ctx context.Context, prc *prContext, aiClient *aihelpers.AIClient, opts reviewOptions) []reviewResult {
+	results := make([]reviewResult, len(opts.Personas))
+	var wg sync.WaitGroup
+	for i, p := range opts.Personas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l := loggerFromCtx(ctx).With("reviewer", p.Name)
+			results[i] = reviewPass(setLoggerToCtx(ctx, l), prc, aiClient, &p, opts)
+			if results[i].Err != nil {
+				l.Error("Review pass failed", "err", results[i].Err)
+				return
+			}
+			l.Info("Review pass finished", "findings", len(results[i].Findings))
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// aggregateReviews combines the passes into one review: their texts under a heading per persona, and their findings
+// deduplicated and attributed to the personas that raised them. It returns how many passes failed, their errors are
+// joined in the result's Err.
+func aggregateReviews(results []reviewResult) (reviewResult, int) {
+	if len(results) == 1 && results[0].Persona == "" {
+		if results[0].Err != nil {
+			return results[0], 1
+		}
+		return results[0], 0
+	}
+
+	var combined reviewResult
+	var texts []string
+	var findings []review.Finding
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("%s review: %w", r.Persona, r.Err))
+			texts = append(texts, "## Review: "+r.Persona+"\n\n_This review pass failed, see the job log._")
+			continue
+		}
+		texts = append(texts, "## Review: "+r.Persona+"\n\n"+r.Text)
+		for _, f := range r.Findings {
+			f.Personas = []string{r.Persona}
+			findings = append(findings, f)
+		}
+		combined.Parsed = combined.Parsed || r.Parsed
+	}
+	combined.Text = strings.Join(texts, "\n\n")
+	combined.Findings = review.Merge(findings)
+	combined.Err = errors.Join(errs...)
+	return combined, len(errs)
+}
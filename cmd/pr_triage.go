@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/LarsOL/NeuroSpecation/aihelpers"
+	"github.com/LarsOL/NeuroSpecation/codehost"
+	"github.com/LarsOL/NeuroSpecation/codeowners"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	triageOff     = "off"
+	triagePreview = "preview"
+	triageApply   = "apply"
+)
+
+// triageCategories are the classes a change can fall into. Labels are opted into per category with --labels.
+var triageCategories = []string{"bug", "feature", "refactor", "docs", "breaking", "security-sensitive"}
+
+const TriagePrompt = "You are a seasoned senior staff software engineer triaging the pull request in the user message. Classify the change into one or more of these categories: " +
+	"bug (fixes incorrect behaviour), feature (adds new behaviour), refactor (restructures code without changing behaviour), docs (documentation only), " +
+	"breaking (changes public APIs, flags, formats or behaviour that users rely on), security-sensitive (touches authentication, authorisation, secrets, cryptography, input validation or other security relevant code). " +
+	"Only pick a category when the diff clearly supports it. Reply with only a ```json block of the form {\"categories\": [\"bug\"], \"reason\": \"one sentence explaining the classification\"}.\n"
+
+type triageResult struct {
+	Categories []string `json:"categories"`
+	Reason     string   `json:"reason"`
+}
+
+// runTriage classifies the change, labels the pull request with the labels opted into for its categories,
+// and requests reviews from the code owners of the changed files and modules.
+func runTriage(ctx context.Context, prc *prContext, host codehost.Host, aiClient *aihelpers.AIClient) error {
+	triager, ok := host.(codehost.Triager)
+	if !ok {
+		return fmt.Errorf("code host does not support labels and reviewers, use --%s %s", triageKey, triageOff)
+	}
+	mode := viper.GetString(triageKey)
+	if viper.GetBool(dryRunKey) {
+		mode = triagePreview
+	}
+
+	var result triageResult
+	prompt := prc.prompt(TriagePrompt, prc.Diff)
+	prompt.expectOutput(100)
+	if viper.GetBool(logPromptKey) {
+		if err := logPromptToFile(prc.Dir, "ai_triage_prompt.txt", prompt.String()); err != nil {
+			return err
+		}
+	}
+	ans, err := promptAI(ctx, aiClient, prompt, viper.GetBool(dryRunKey))
+	if err != nil {
+		return err
+	}
+	if !viper.GetBool(dryRunKey) {
+		block, err := extractBlock(ans, "json")
+		if err != nil {
+			return fmt.Errorf("expected triage output to contain a json block: %w", err)
+		}
+		if err := json.Unmarshal([]byte(block), &result); err != nil {
+			return fmt.Errorf("failed to parse triage output: %w", err)
+		}
+	}
+	categories := slices.DeleteFunc(result.Categories, func(c string) bool { return !slices.Contains(triageCategories, c) })
+
+	repoLabels, err := triager.RepoLabels(ctx)
+	if err != nil {
+		return err
+	}
+	labels := triageLabels(categories, viper.GetStringMapString(labelsKey), repoLabels, prc.PR.Labels)
+
+	reviewers, err := suggestReviewers(prc, viper.GetInt(maxReviewersKey))
+	if err != nil {
+		return err
+	}
+	// Reviewers are only requested once, requesting them again on every push would notify them again
+	requestReviewers := prc.Prior == nil
+
+	fmt.Print(triageSummary(categories, result.Reason, labels, reviewers, mode == triagePreview))
+	if mode == triagePreview {
+		return nil
+	}
+
+	if err := triager.AddLabels(ctx, prc.PR, labels); err != nil {
+		return err
+	}
+	if requestReviewers {
+		if err := triager.RequestReviewers(ctx, prc.PR, reviewers); err != nil {
+			return err
+		}
+	}
+	loggerFromCtx(ctx).Info("Triaged PR", "labels", labels, "reviewers", reviewers, "requested", requestReviewers)
+	return nil
+}
+
+// triageLabels maps the categories to the opted in labels that exist in the repository and are not on the PR yet.
+func triageLabels(categories []string, optIn map[string]string, repoLabels, prLabels []string) []string {
+	var labels []string
+	for _, c := range categories {
+		want, ok := optIn[c]
+		if !ok {
+			continue
+		}
+		// Use the repository's spelling of the label
+		idx := slices.IndexFunc(repoLabels, func(l string) bool { return strings.EqualFold(l, want) })
+		if idx < 0 {
+			continue
+		}
+		label := repoLabels[idx]
+		if !slices.ContainsFunc(prLabels, func(l string) bool { return strings.EqualFold(l, label) }) && !slices.Contains(labels, label) {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// suggestReviewers ranks the CODEOWNERS owners by how many of the changed files, and of the touched modules
+// (directories with an ai_knowledge.yaml), they own. The pull request author is never suggested.
+func suggestReviewers(prc *prContext, maxReviewers int) ([]string, error) {
+	rules, err := codeowners.Load(prc.GitRoot)
+	if err != nil || rules == nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	count := func(path string) {
+		for _, owner := range rules.Owners(path) {
+			owner = strings.TrimPrefix(owner, "@")
+			// Owners given as email addresses cannot be requested as reviewers
+			if strings.Contains(owner, "@") || strings.EqualFold(owner, prc.PR.Author) {
+				continue
+			}
+			counts[owner]++
+		}
+	}
+
+	modules := map[string]bool{}
+	for _, file := range diffFiles(prc.Diff) {
+		count(file)
+		dir := filepath.Dir(file)
+		if modules[dir] {
+			continue
+		}
+		modules[dir] = true
+		if _, err := os.Stat(filepath.Join(prc.GitRoot, dir, "ai_knowledge.yaml")); err == nil {
+			count(dir)
+		}
+	}
+
+	var reviewers []string
+	for owner := range counts {
+		reviewers = append(reviewers, owner)
+	}
+	slices.SortFunc(reviewers, func(a, b string) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+	if len(reviewers) > maxReviewers {
+		reviewers = reviewers[:maxReviewers]
+	}
+	return reviewers, nil
+}
+
+func triageSummary(categories []string, reason string, labels, reviewers []string, preview bool) string {
+	var sb strings.Builder
+	if preview {
+		sb.WriteString("**Triage preview:** nothing is applied\n\n")
+	} else {
+		sb.WriteString("**Triage:**\n\n")
+	}
+	list := func(items []string) string {
+		if len(items) == 0 {
+			return "none"
+		}
+		return strings.Join(items, ", ")
+	}
+	sb.WriteString("- Categories: " + list(categories))
+	if reason != "" {
+		sb.WriteString(" (" + reason + ")")
+	}
+	sb.WriteString("\n- Labels: " + list(labels) + "\n- Reviewers: " + list(reviewers) + "\n\n")
+	return sb.String()
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"github.com/LarsOL/NeuroSpecation/aihelpers"
+	"github.com/LarsOL/NeuroSpecation/promptguard"
+	"github.com/LarsOL/NeuroSpecation/prompts"
+	"strings"
+)
+
+// guardedPrompt keeps the instructions, sent in the system role, apart from the untrusted repository and pull
+// request content they apply to, which is wrapped in delimiters the content cannot guess.
+type guardedPrompt struct {
+	delim  promptguard.Delimiter
+	system strings.Builder
+	user   strings.Builder
+	// output is the expected answer length in tokens for dry-run estimates, 0 for defaultOutputTokens
+	output int
+	// model, if set, is used instead of the client's model
+	model string
+}
+
+func newGuardedPrompt(instructions string) *guardedPrompt {
+	p := &guardedPrompt{delim: promptguard.NewDelimiter()}
+	p.system.WriteString(instructions)
+	return p
+}
+
+// newTemplatedPrompt renders a prompt template, which places the instructions and wraps the data itself.
+func newTemplatedPrompt(t *prompts.Template, data prompts.Data) (*guardedPrompt, error) {
+	p := &guardedPrompt{delim: promptguard.NewDelimiter()}
+	system, user, err := t.Render(p.delim, data)
+	if err != nil {
+		return nil, err
+	}
+	p.system.WriteString(system)
+	p.user.WriteString(user)
+	return p, nil
+}
+
+// instruct adds trusted instructions.
+func (p *guardedPrompt) instruct(text string) {
+	p.system.WriteString("\n" + text + "\n")
+}
+
+// data adds untrusted content, described by label.
+func (p *guardedPrompt) data(label, content string) {
+	p.user.WriteString(p.delim.Wrap(label, content) + "\n")
+}
+
+// expectOutput sets the expected answer length in tokens, for prompts with notably short or long answers.
+func (p *guardedPrompt) expectOutput(tokens int) {
+	p.output = tokens
+}
+
+func (p *guardedPrompt) expectedOutput() int {
+	if p.output == 0 {
+		return defaultOutputTokens
+	}
+	return p.output
+}
+
+// useModel sends the prompt to model instead of the client's model.
+func (p *guardedPrompt) useModel(model string) {
+	p.model = model
+}
+
+func (p *guardedPrompt) request() aihelpers.PromptRequest {
+	return aihelpers.PromptRequest{System: p.system.String() + p.delim.Rules(), Prompt: p.user.String(), Model: p.model}
+}
+
+// String shows both messages, for logging the prompt.
+func (p *guardedPrompt) String() string {
+	req := p.request()
+	return "<System Message>\n" + req.System + "\n</System Message>\n\n<User Message>\n" + req.Prompt + "\n</User Message>\n"
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/LarsOL/NeuroSpecation/prompts"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var promptsCmd = &cobra.Command{
+	Use:   "prompts",
+	Short: "Inspect the prompt templates",
+	Long: `Inspect the prompt templates. Templates are read from the config, then from
+` + prompts.Dir + `/<name>.tmpl in the repository, falling back to the built-in ones.`,
+}
+
+var promptsShowCmd = &cobra.Command{
+	Use:       "show [name]",
+	Short:     "Print the effective prompt template, or list the templates and where they come from",
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: prompts.Names,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Not validated, so that an invalid template can still be inspected
+		set, err := prompts.LoadAll(promptOverrides(promptsDir(), "")...)
+		if err != nil {
+			slog.Error("Could not load the prompt templates", "err", err)
+			os.Exit(exitCodeError)
+		}
+		if len(args) == 0 {
+			for _, name := range prompts.Names {
+				fmt.Printf("%s\t%s\n", name, set[name].Origin)
+			}
+			return
+		}
+		if !slices.Contains(prompts.Names, args[0]) {
+			slog.Error("Unknown prompt template", "name", args[0], "names", prompts.Names)
+			os.Exit(exitCodeError)
+		}
+		t := set[args[0]]
+		slog.Info("Prompt template", "name", t.Name, "origin", t.Origin)
+		fmt.Print(t.Source)
+	},
+}
+
+var promptsValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check that the prompt templates parse, render and keep repository data out of the instructions",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		overrides := promptOverrides(promptsDir(), "")
+		failed := false
+		for _, name := range prompts.Names {
+			t, err := prompts.Load(name, overrides...)
+			if err == nil {
+				err = t.Validate()
+			}
+			if err != nil {
+				slog.Error("Invalid prompt template", "name", name, "err", err)
+				failed = true
+				continue
+			}
+			slog.Info("Valid prompt template", "name", name, "origin", t.Origin)
+		}
+		if failed {
+			os.Exit(exitCodeError)
+		}
+	},
+}
+
+// promptsDir is the directory whose repository templates are used.
+func promptsDir() string {
+	if dir := viper.GetString(dirKey); dir != "" {
+		return dir
+	}
+	return "."
+}
+
+func init() {
+	promptsCmd.AddCommand(promptsShowCmd)
+	promptsCmd.AddCommand(promptsValidateCmd)
+	rootCmd.AddCommand(promptsCmd)
+}
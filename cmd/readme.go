@@ -5,12 +5,13 @@ import (
 	"fmt"
 	"github.com/LarsOL/NeuroSpecation/aihelpers"
 	"github.com/LarsOL/NeuroSpecation/dirhelper"
+	"github.com/LarsOL/NeuroSpecation/pathpolicy"
+	"github.com/LarsOL/NeuroSpecation/prompts"
 	"github.com/spf13/viper"
 	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -32,7 +33,7 @@ var readmeCmd = &cobra.Command{
 		}))
 		slog.SetDefault(l)
 
-		ctx := context.Background()
+		ctx := cmd.Context()
 		ctx = setLoggerToCtx(ctx, l)
 
 		slog.Debug("Command line arguments", "args", os.Args)
@@ -52,22 +53,31 @@ var readmeCmd = &cobra.Command{
 
 		if viper.GetBool(dryRunKey) {
 			slog.Info("Dry-run mode enabled")
+			var err error
+			ctx, err = startDryRun(ctx)
+			if err != nil {
+				slog.Error("Could not start the dry run", "err", err)
+				os.Exit(1)
+			}
 		} else {
 			slog.Debug("Dry-run mode disabled")
 		}
 
 		var aiClient *aihelpers.AIClient
 		if !viper.GetBool(dryRunKey) {
-			apiKey := os.Getenv("OPENAI_API_KEY")
-			if apiKey == "" {
-				slog.Error("API key is not set")
+			var err error
+			aiClient, err = newAIClient()
+			if err != nil {
+				slog.Error("Could not create the AI client", "err", err)
 				os.Exit(1)
 			}
-			aiClient = aihelpers.NewOpenAIClient(apiKey, viper.GetString(modelKey))
 		}
 
 		slog.Info("Creating AI README")
 		err := CreateReadMe(ctx, directory, aiClient)
+		logUsage(aiClient)
+		estimateFromCtx(ctx).report()
+		exitOnBudget(aiClient, err)
 		if err != nil {
 			slog.Error("Error creating readme", "err", err)
 			os.Exit(1)
@@ -90,21 +100,30 @@ func init() {
 	// readmeCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-const ReadmePrompt = "You are an seasoned senior staff software engineer. Your task is to create a comprehensive and well-organized README file for the repository using only the provided AI-generated summary. Do not guess or add any additional details that are not present in the input.\n\nThe README should be written in Markdown and include the following sections (include only the sections for which there is relevant information):\n\n1. **Overview**  \n   - A brief introduction to the repository, its purpose, and high-level functionality.\n\n2. **Business Processes**  \n   - A description of the core business processes or domain-specific operations supported by the repository.\n\n3. **Module Overview**  \n   - An outline of the main module(s), including their roles, responsibilities, and key features.\n\n4. **Architectural Patterns**  \n   - An explanation of the architectural patterns or design principles employed.\n\n5. **Key Files**  \n   - A list and description of the critical files or components and their purposes.\n\n6. **Inter-Module Relationships**  \n   - Details on any dependencies, integrations, or interactions between modules.\n\n7. **Additional Insights**  \n   - Any further relevant details such as performance considerations, security aspects, testing strategies, or scalability notes.\n\nBelow is the provided AI-generated summary information:\n"
-
 func CreateReadMe(ctx context.Context, dir string, aiClient *aihelpers.AIClient) error {
-	prompt, err := gatherAIKnowledgeForReadMe(dir)
+	paths, err := loadPathPolicy(dir, "")
+	if err != nil {
+		return err
+	}
+	defer writePathAudit(dir, paths)
+
+	templates, err := loadPrompts(dir, "")
+	if err != nil {
+		return err
+	}
+
+	prompt, err := gatherAIKnowledgeForReadMe(templates[prompts.Readme], dir, paths)
 	if err != nil {
 		return err
 	}
 
 	if viper.GetBool(logPromptKey) {
-		if err := logPromptToFile(dir, "ai_readme_prompt.txt", prompt); err != nil {
+		if err := logPromptToFile(dir, "ai_readme_prompt.txt", prompt.String()); err != nil {
 			return err
 		}
 	}
 
-	ans, err := promptAI(ctx, aiClient, prompt, viper.GetBool(dryRunKey))
+	ans, err := promptAI(aihelpers.WithAuditTarget(ctx, dir), aiClient, prompt, viper.GetBool(dryRunKey))
 	if err != nil {
 		return err
 	}
@@ -112,26 +131,27 @@ func CreateReadMe(ctx context.Context, dir string, aiClient *aihelpers.AIClient)
 	return writeReadMe(dir, ans, viper.GetBool(dryRunKey))
 }
 
-func gatherAIKnowledgeForReadMe(dir string) (string, error) {
-	var prompt strings.Builder
-	prompt.WriteString(ReadmePrompt)
-	prompt.WriteString("\n<Summarised AI knowledge base>\n")
-	err := dirhelper.WalkDirectories(dir, func(d string, files []dirhelper.FileContent, subdirs []string) error {
+func gatherAIKnowledgeForReadMe(tmpl *prompts.Template, dir string, paths *pathpolicy.Policy) (*guardedPrompt, error) {
+	var data prompts.Data
+	err := dirhelper.WalkDirectoriesWithPolicy(dir, paths, func(d string, files []dirhelper.FileContent, subdirs []string) error {
 		slog.Debug("Processing Directory", "Dir", d)
 		for _, file := range files {
 			slog.Debug("Processing file", "File", file.Name)
-			prompt.WriteString("- " + file.FullPath() + "\n")
-			prompt.WriteString(file.Content + "\n")
+			data.Files = append(data.Files, prompts.File{Name: file.FullPath(), Content: file.Content})
 		}
 		return nil
 	}, func(node fs.DirEntry) bool {
 		return node.IsDir() || node.Name() == "ai_knowledge.yaml"
 	})
 	if err != nil {
-		return "", fmt.Errorf("error walking directories: %w", err)
+		return nil, fmt.Errorf("error walking directories: %w", err)
+	}
+	p, err := newTemplatedPrompt(tmpl, data)
+	if err != nil {
+		return nil, err
 	}
-	prompt.WriteString("</Summarised AI knowledge base>\n")
-	return prompt.String(), nil
+	p.expectOutput(1500)
+	return p, nil
 }
 
 func writeReadMe(dir, ans string, dryRun bool) error {
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"context"
+	"github.com/LarsOL/NeuroSpecation/aihelpers"
+	"github.com/LarsOL/NeuroSpecation/pathpolicy"
 	"github.com/fsnotify/fsnotify"
 	"log/slog"
 	"os"
@@ -12,6 +14,14 @@ import (
 
 var cfgFile string
 
+// trustedConfig holds the settings deciding what is sent to the AI provider and how it is recorded, see trustedKeys.
+// The repository's config file is not read into it: it is part of the pull request under review, which must not be
+// able to loosen them.
+var trustedConfig = viper.New()
+
+// trustedKeys are only read from the flags, the environment and the config file in $HOME or given with --config.
+var trustedKeys = []string{providerKey, pathPolicyKey, redactKey, redactPatternsKey, auditKey, auditLogKey, auditMaxSizeKey, auditMaxFilesKey}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "neurospecation",
@@ -24,25 +34,62 @@ func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
 		slog.Error("Error:", "err", err)
-		os.Exit(1)
+		os.Exit(exitCodeError)
 	}
 }
 
+// Exit codes, so CI can tell failures apart from policy decisions.
+const (
+	exitCodeError    = 1
+	exitCodeFindings = 2
+	exitCodeBudget   = 3
+)
+
 const dryRunKey = "dry-run"
 const debugKey = "debug"
 const modelKey = "model"
 const dirKey = "dir"
 const logPromptKey = "log-prompts"
+const throttleKey = "throttle"
+const redactKey = "redact"
+const redactPatternsKey = "redact-patterns"
+const providerKey = "provider"
+const pathPolicyKey = "path-policy"
+const auditKey = "audit"
+const auditLogKey = "audit-log"
+const auditMaxSizeKey = "audit-max-size"
+const auditMaxFilesKey = "audit-max-files"
+const dryRunPromptsKey = "dry-run-prompts"
+const maxCostKey = "max-cost"
+const maxTokensKey = "max-tokens"
+
+// promptsKey is a config file only setting, mapping prompt template names to the files overriding them
+const promptsKey = "prompts"
+
+// pricesKey is a config file only setting, mapping model names to their input and output price per million tokens
+const pricesKey = "prices"
 
 func init() {
 	cobra.OnInitialize(initConfig)
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.NeuroSpecation.yaml)")
 	rootCmd.PersistentFlags().BoolP(debugKey, "d", false, "Enable debug logging")
-	rootCmd.PersistentFlags().Bool(dryRunKey, false, "Enable dry-run mode")
+	rootCmd.PersistentFlags().Bool(dryRunKey, false, "Enable dry-run mode, estimating the tokens and cost of the prompts instead of sending them")
+	rootCmd.PersistentFlags().Bool(dryRunPromptsKey, false, "In dry-run mode, write the prompts to a temporary directory for inspection")
 	rootCmd.PersistentFlags().StringP(modelKey, "m", "gpt-4o", "The model to use for AI requests")
 	rootCmd.PersistentFlags().StringP(dirKey, "", "", "Directory to run on")
 	rootCmd.PersistentFlags().Bool(logPromptKey, false, "Debug: Log prompts to file")
+	rootCmd.PersistentFlags().Int(throttleKey, 500, "API limit in requests per minute, shared by all concurrent requests")
+	rootCmd.PersistentFlags().Bool(redactKey, true, "Replace keys, tokens and other secrets in prompts with placeholders before they are sent")
+	rootCmd.PersistentFlags().String(providerKey, "openai", "Name of the AI provider, selects its rules in the path policy")
+	rootCmd.PersistentFlags().String(pathPolicyKey, "", "Path policy file listing what may be sent to each AI provider (default: "+pathpolicy.FileName+" in the repository root)")
+	rootCmd.PersistentFlags().Bool(auditKey, true, "Append a record of every AI request and response to the audit log")
+	rootCmd.PersistentFlags().String(auditLogKey, "", "Audit log file (default is $HOME/.neurospecation/audit.jsonl)")
+	rootCmd.PersistentFlags().Int(auditMaxSizeKey, 10, "Size in MB at which the audit log is rotated")
+	rootCmd.PersistentFlags().Int(auditMaxFilesKey, 5, "Number of rotated audit log files to keep")
+	rootCmd.PersistentFlags().Float64(maxCostKey, 0, "Stop sending AI requests once their estimated cost exceeds this many USD (0: no limit)")
+	rootCmd.PersistentFlags().Int64(maxTokensKey, 0, "Stop sending AI requests once they used more than this many tokens (0: no limit)")
+	rootCmd.PersistentFlags().StringSlice(redactPatternsKey, nil, "Extra regular expressions to redact from prompts, a group named secret limits the redaction to that group")
 
 	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
 		lvl := new(slog.LevelVar)
@@ -60,6 +107,7 @@ func init() {
 
 		ctx := context.Background()
 		ctx = setLoggerToCtx(ctx, l)
+		ctx = aihelpers.WithAuditCommand(ctx, cmd.Name())
 		cmd.SetContext(ctx)
 	}
 
@@ -73,41 +121,60 @@ func init() {
 		slog.Error("could not bind to persistent flags:", "err", err)
 		os.Exit(1)
 	}
+	for _, key := range trustedKeys {
+		if err := trustedConfig.BindPFlag(key, rootCmd.PersistentFlags().Lookup(key)); err != nil {
+			slog.Error("could not bind to persistent flags:", "err", err)
+			os.Exit(1)
+		}
+	}
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
+	var home, gitRoot string
+	if cfgFile == "" {
+		var err error
 		// Find home directory.
-		home, err := os.UserHomeDir()
+		home, err = os.UserHomeDir()
 		if err != nil {
 			slog.Error("Could not get home directory to load config", "err", err)
-		} else {
-			viper.AddConfigPath(home)
 		}
-
-		gitRoot, err := getGitRoot(".")
+		gitRoot, err = getGitRoot(".")
 		if err != nil {
 			slog.Error("Could not get git root to load config", "err", err)
-		} else {
-			viper.AddConfigPath(gitRoot)
 		}
-		viper.SetConfigType("yaml")
-		viper.SetConfigName(".neurospecation")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
-
 	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
+	if err := readConfig(viper.GetViper(), cfgFile, home, gitRoot); err == nil {
 		slog.Info("Using config file:", "file", viper.ConfigFileUsed())
 	}
+	if err := readConfig(trustedConfig, cfgFile, home); err == nil {
+		slog.Debug("Using config file for the trusted settings:", "file", trustedConfig.ConfigFileUsed(), "keys", trustedKeys)
+	}
 
 	viper.OnConfigChange(func(e fsnotify.Event) {
 		slog.Info("Config file changed:", "file", e.Name)
 	})
 	viper.WatchConfig()
 }
+
+// readConfig reads the environment and the config file into v: the file given with --config, otherwise the first
+// .neurospecation.yaml found in dirs.
+func readConfig(v *viper.Viper, file string, dirs ...string) error {
+	if file != "" {
+		// Use config file from the flag.
+		v.SetConfigFile(file)
+	} else {
+		for _, dir := range dirs {
+			if dir != "" {
+				v.AddConfigPath(dir)
+			}
+		}
+		v.SetConfigType("yaml")
+		v.SetConfigName(".neurospecation")
+	}
+
+	v.AutomaticEnv() // read in environment variables that match
+	return v.ReadInConfig()
+}
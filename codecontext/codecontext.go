@@ -0,0 +1,583 @@
+// Package codecontext gathers the Go code around a change that the diff alone does not show:
+// the whole declarations enclosing the changed lines, and the code referencing the changed exported symbols.
+package codecontext
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Options bound how much context is gathered.
+type Options struct {
+	// Budget is the maximum total size of the snippets in bytes
+	Budget int
+	// MaxReferences is the maximum number of references gathered per changed exported symbol
+	MaxReferences int
+	// Withholds, if set, reports the files, relative to the repository root, whose code must not be included
+	Withholds func(path string) bool
+}
+
+// Snippet is a whole top-level declaration, or a single spec of a grouped declaration.
+type Snippet struct {
+	Path      string
+	StartLine int
+	EndLine   int
+	// Reason says why the snippet was included
+	Reason string
+	Code   string
+}
+
+// Context is the gathered code, in order of importance.
+type Context struct {
+	Snippets []Snippet
+	// Omitted counts the snippets left out to stay within the budget
+	Omitted int
+}
+
+// String renders the snippets as fenced Go code blocks, or "" when there are none.
+func (c Context) String() string {
+	var sb strings.Builder
+	for _, s := range c.Snippets {
+		sb.WriteString(fmt.Sprintf("%s lines %d-%d, %s:\n```go\n%s\n```\n\n", s.Path, s.StartLine, s.EndLine, s.Reason, s.Code))
+	}
+	if c.Omitted > 0 {
+		sb.WriteString(fmt.Sprintf("%d more declarations were left out to stay within the context budget.\n", c.Omitted))
+	}
+	return sb.String()
+}
+
+// Gather collects the context of the Go files changed in diff, reading them from the working tree at gitRoot.
+// Files that do not parse are skipped, references are only resolved as far as the code type checks without its imports.
+func Gather(gitRoot, diff string, opts Options) (Context, error) {
+	g := &gatherer{
+		gitRoot: gitRoot,
+		fset:    token.NewFileSet(),
+		files:   map[string]*ast.File{},
+		sources: map[string][]byte{},
+		seen:    map[string]bool{},
+	}
+
+	changed := ChangedLines(diff)
+	byDir := map[string][]string{}
+	for file := range changed {
+		if strings.HasSuffix(file, ".go") {
+			byDir[path.Dir(file)] = append(byDir[path.Dir(file)], file)
+		}
+	}
+
+	var changedSnippets []Snippet
+	var symbols []*symbol
+	for _, dir := range slices.Sorted(maps.Keys(byDir)) {
+		pkgs, err := g.parseDir(dir)
+		if err != nil {
+			return Context{}, err
+		}
+		for _, pkg := range pkgs {
+			for _, file := range slices.Sorted(slices.Values(byDir[dir])) {
+				f := g.files[file]
+				if f == nil || !slices.Contains(pkg.files, f) {
+					continue
+				}
+				snippets, syms := g.changedDecls(file, f, pkg, changed[file])
+				changedSnippets = append(changedSnippets, snippets...)
+				symbols = append(symbols, syms...)
+			}
+		}
+	}
+
+	if len(symbols) > 0 {
+		if err := g.findPackageReferences(symbols); err != nil {
+			return Context{}, err
+		}
+	}
+
+	var ctx Context
+	size := 0
+	add := func(s Snippet) {
+		if opts.Withholds != nil && opts.Withholds(s.Path) {
+			return
+		}
+		if size+len(s.Code) > opts.Budget {
+			ctx.Omitted++
+			return
+		}
+		size += len(s.Code)
+		ctx.Snippets = append(ctx.Snippets, s)
+	}
+	for _, s := range changedSnippets {
+		add(s)
+	}
+	for _, sym := range symbols {
+		slices.SortFunc(sym.refs, func(a, b reference) int {
+			// References from the symbol's own package first
+			return cmp.Or(-cmp.Compare(boolInt(a.samePkg), boolInt(b.samePkg)), cmp.Compare(a.path, b.path), cmp.Compare(a.line, b.line))
+		})
+		n := 0
+		for _, ref := range sym.refs {
+			if n >= opts.MaxReferences {
+				break
+			}
+			s, ok := g.enclosingSnippet(ref.path, ref.line, "references "+sym.name)
+			if !ok {
+				continue
+			}
+			n++
+			add(s)
+		}
+	}
+	return ctx, nil
+}
+
+// ChangedLines returns, per file, the new-side lines a git diff adds, and the lines next to which it deletes. The "---"
+// and "+++" file headers are only recognised before a file's first hunk.
+func ChangedLines(diff string) map[string][]int {
+	lines := map[string][]int{}
+	var file string
+	newLine := 0
+	inHunk := false
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		l := scanner.Text()
+		switch {
+		case strings.HasPrefix(l, "diff --git"):
+			file, newLine, inHunk = "", 0, false
+		case !inHunk && strings.HasPrefix(l, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(l, "+++ "), "b/")
+			if file == "/dev/null" {
+				file = ""
+			}
+		case !inHunk && strings.HasPrefix(l, "--- "):
+		case strings.HasPrefix(l, "@@"):
+			newLine = hunkStart(l)
+			inHunk = true
+		case newLine == 0 || file == "":
+			continue
+		case strings.HasPrefix(l, "+"), strings.HasPrefix(l, "-"):
+			if n := len(lines[file]); n == 0 || lines[file][n-1] != newLine {
+				lines[file] = append(lines[file], newLine)
+			}
+			if strings.HasPrefix(l, "+") {
+				newLine++
+			}
+		case strings.HasPrefix(l, " "):
+			newLine++
+		}
+	}
+	return lines
+}
+
+// hunkStart returns the first new-side line of a "@@ -a,b +c,d @@" hunk header, or 0 if it is malformed.
+func hunkStart(header string) int {
+	_, after, ok := strings.Cut(header, " +")
+	if !ok {
+		return 0
+	}
+	start, _, _ := strings.Cut(after, " ")
+	start, _, _ = strings.Cut(start, ",")
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+type gatherer struct {
+	gitRoot string
+	fset    *token.FileSet
+	// files and sources are keyed by the slash separated path relative to gitRoot
+	files   map[string]*ast.File
+	sources map[string][]byte
+	// seen holds the snippets already gathered, by path and start line
+	seen map[string]bool
+}
+
+// goPackage is a type checked package. Test files of an external _test package form a package of their own.
+type goPackage struct {
+	dir   string
+	name  string
+	files []*ast.File
+	info  *types.Info
+}
+
+// symbol is a changed exported declaration.
+type symbol struct {
+	name string
+	obj  types.Object
+	pkg  *goPackage
+	// method symbols can only be found through type information, so only in their own package
+	method bool
+	refs   []reference
+}
+
+type reference struct {
+	path    string
+	line    int
+	samePkg bool
+}
+
+func (g *gatherer) parseFile(file string, mode parser.Mode) (*ast.File, error) {
+	if f, ok := g.files[file]; ok {
+		return f, nil
+	}
+	src, err := os.ReadFile(filepath.Join(g.gitRoot, filepath.FromSlash(file)))
+	if err != nil {
+		return nil, err
+	}
+	f, err := parser.ParseFile(g.fset, file, src, mode)
+	if err != nil {
+		return nil, err
+	}
+	g.files[file] = f
+	g.sources[file] = src
+	return f, nil
+}
+
+// parseDir parses and type checks the Go files in dir, grouped by package name.
+func (g *gatherer) parseDir(dir string) ([]*goPackage, error) {
+	entries, err := os.ReadDir(filepath.Join(g.gitRoot, filepath.FromSlash(dir)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	var pkgs []*goPackage
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") {
+			continue
+		}
+		f, err := g.parseFile(path.Join(dir, e.Name()), parser.ParseComments)
+		if err != nil {
+			// A file that does not parse only loses its context
+			continue
+		}
+		idx := slices.IndexFunc(pkgs, func(p *goPackage) bool { return p.name == f.Name.Name })
+		if idx < 0 {
+			pkgs = append(pkgs, &goPackage{dir: dir, name: f.Name.Name})
+			idx = len(pkgs) - 1
+		}
+		pkgs[idx].files = append(pkgs[idx].files, f)
+	}
+
+	for _, pkg := range pkgs {
+		pkg.info = &types.Info{
+			Defs: map[*ast.Ident]types.Object{},
+			Uses: map[*ast.Ident]types.Object{},
+		}
+		conf := types.Config{
+			// Imports are not loaded, identifiers from other packages stay unresolved
+			Importer: importerFunc(func(path string) (*types.Package, error) {
+				return nil, fmt.Errorf("%s is not loaded", path)
+			}),
+			Error: func(error) {},
+		}
+		// Type errors are expected without imports, whatever resolves is recorded in info
+		_, _ = conf.Check(pkg.dir, g.fset, pkg.files, pkg.info)
+	}
+	return pkgs, nil
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// changedDecls returns the declarations of f enclosing the changed lines, and the exported symbols they declare.
+func (g *gatherer) changedDecls(file string, f *ast.File, pkg *goPackage, lines []int) ([]Snippet, []*symbol) {
+	var snippets []Snippet
+	var symbols []*symbol
+	for _, node := range declNodes(f) {
+		start, end := g.lines(node)
+		changedLines := 0
+		for _, l := range lines {
+			if l >= start && l <= end {
+				changedLines++
+			}
+		}
+		if changedLines == 0 {
+			continue
+		}
+		// A declaration added in full is already in the diff
+		if changedLines < end-start+1 {
+			if s, ok := g.snippet(file, node, "enclosing a change"); ok {
+				snippets = append(snippets, s)
+			}
+		}
+		for _, ident := range declaredIdents(node) {
+			if !ident.IsExported() {
+				continue
+			}
+			obj := pkg.info.Defs[ident]
+			if obj == nil {
+				continue
+			}
+			sym := &symbol{name: ident.Name, obj: obj, pkg: pkg}
+			if fn, ok := node.(*ast.FuncDecl); ok && fn.Recv != nil {
+				recv := receiverName(fn)
+				if !ast.IsExported(recv) {
+					continue
+				}
+				sym.name = recv + "." + ident.Name
+				sym.method = true
+			}
+			symbols = append(symbols, sym)
+		}
+	}
+	return snippets, symbols
+}
+
+// findPackageReferences records the references to the symbols, within their own package through the type information,
+// and from the other packages of the module through selectors on the package's import.
+func (g *gatherer) findPackageReferences(symbols []*symbol) error {
+	byObj := map[types.Object]*symbol{}
+	for _, sym := range symbols {
+		byObj[sym.obj] = sym
+	}
+	checked := map[*goPackage]bool{}
+	for _, sym := range symbols {
+		if checked[sym.pkg] {
+			continue
+		}
+		checked[sym.pkg] = true
+		for ident, obj := range sym.pkg.info.Uses {
+			s, ok := byObj[obj]
+			if !ok {
+				continue
+			}
+			pos := g.fset.Position(ident.Pos())
+			s.refs = append(s.refs, reference{path: pos.Filename, line: pos.Line, samePkg: true})
+		}
+	}
+
+	module := modulePath(g.gitRoot)
+	if module == "" {
+		return nil
+	}
+	// Exported package level symbols, by the import path of their package
+	byImport := map[string]map[string]*symbol{}
+	for _, sym := range symbols {
+		if sym.method || sym.pkg.name == "main" || strings.HasSuffix(sym.pkg.name, "_test") {
+			continue
+		}
+		importPath := module
+		if sym.pkg.dir != "." {
+			importPath = module + "/" + sym.pkg.dir
+		}
+		if byImport[importPath] == nil {
+			byImport[importPath] = map[string]*symbol{}
+		}
+		byImport[importPath][sym.obj.Name()] = sym
+	}
+	if len(byImport) == 0 {
+		return nil
+	}
+
+	return filepath.WalkDir(g.gitRoot, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != g.gitRoot && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(p, ".go") {
+			return nil
+		}
+		rel, err := filepath.Rel(g.gitRoot, p)
+		if err != nil {
+			return err
+		}
+		file := filepath.ToSlash(rel)
+
+		imports, err := parser.ParseFile(token.NewFileSet(), p, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil
+		}
+		// The local names the file imports the changed packages under
+		local := map[string]map[string]*symbol{}
+		for _, imp := range imports.Imports {
+			importPath := strings.Trim(imp.Path.Value, `"`)
+			syms, ok := byImport[importPath]
+			if !ok {
+				continue
+			}
+			name := ""
+			for _, sym := range syms {
+				name = sym.pkg.name
+				break
+			}
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			local[name] = syms
+		}
+		if len(local) == 0 {
+			return nil
+		}
+
+		f, err := g.parseFile(file, parser.ParseComments)
+		if err != nil {
+			return nil
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			x, ok := sel.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if sym, ok := local[x.Name][sel.Sel.Name]; ok {
+				sym.refs = append(sym.refs, reference{path: file, line: g.fset.Position(sel.Pos()).Line})
+			}
+			return true
+		})
+		return nil
+	})
+}
+
+// enclosingSnippet returns the declaration enclosing the line, unless it was already gathered.
+func (g *gatherer) enclosingSnippet(file string, line int, reason string) (Snippet, bool) {
+	f := g.files[file]
+	if f == nil {
+		return Snippet{}, false
+	}
+	for _, node := range declNodes(f) {
+		start, end := g.lines(node)
+		if line >= start && line <= end {
+			return g.snippet(file, node, reason)
+		}
+	}
+	return Snippet{}, false
+}
+
+func (g *gatherer) snippet(file string, node ast.Node, reason string) (Snippet, bool) {
+	start, end := g.lines(node)
+	key := fmt.Sprintf("%s:%d", file, start)
+	if g.seen[key] {
+		return Snippet{}, false
+	}
+	g.seen[key] = true
+
+	from, to := g.fset.Position(nodeStart(node)).Offset, g.fset.Position(node.End()).Offset
+	return Snippet{Path: file, StartLine: start, EndLine: end, Reason: reason, Code: string(g.sources[file][from:to])}, true
+}
+
+func (g *gatherer) lines(node ast.Node) (int, int) {
+	return g.fset.Position(nodeStart(node)).Line, g.fset.Position(node.End()).Line
+}
+
+// declNodes lists the top-level declarations of f, without the imports. Grouped declarations are split into their specs,
+// so a change to one constant does not pull in the whole block.
+func declNodes(f *ast.File) []ast.Node {
+	var nodes []ast.Node
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if ok && gen.Tok == token.IMPORT {
+			continue
+		}
+		if !ok || !gen.Lparen.IsValid() {
+			nodes = append(nodes, decl)
+			continue
+		}
+		for _, spec := range gen.Specs {
+			nodes = append(nodes, spec)
+		}
+	}
+	return nodes
+}
+
+// nodeStart includes the doc comment in the declaration.
+func nodeStart(node ast.Node) token.Pos {
+	var doc *ast.CommentGroup
+	switch n := node.(type) {
+	case *ast.FuncDecl:
+		doc = n.Doc
+	case *ast.GenDecl:
+		doc = n.Doc
+	case *ast.TypeSpec:
+		doc = n.Doc
+	case *ast.ValueSpec:
+		doc = n.Doc
+	}
+	if doc != nil {
+		return doc.Pos()
+	}
+	return node.Pos()
+}
+
+func declaredIdents(node ast.Node) []*ast.Ident {
+	switch n := node.(type) {
+	case *ast.FuncDecl:
+		return []*ast.Ident{n.Name}
+	case *ast.GenDecl:
+		var idents []*ast.Ident
+		for _, spec := range n.Specs {
+			idents = append(idents, declaredIdents(spec)...)
+		}
+		return idents
+	case *ast.TypeSpec:
+		return []*ast.Ident{n.Name}
+	case *ast.ValueSpec:
+		return n.Names
+	}
+	return nil
+}
+
+func receiverName(fn *ast.FuncDecl) string {
+	if len(fn.Recv.List) == 0 {
+		return ""
+	}
+	t := fn.Recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	switch r := t.(type) {
+	case *ast.IndexExpr:
+		t = r.X
+	case *ast.IndexListExpr:
+		t = r.X
+	}
+	if ident, ok := t.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// modulePath reads the module path from the go.mod at the repository root, or "" if there is none.
+func modulePath(gitRoot string) string {
+	content, err := os.ReadFile(filepath.Join(gitRoot, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if after, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			return strings.Trim(strings.TrimSpace(after), `"`)
+		}
+	}
+	return ""
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
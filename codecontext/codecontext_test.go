@@ -0,0 +1,193 @@
+package codecontext
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testDiff = `diff --git a/shapes/area.go b/shapes/area.go
+--- a/shapes/area.go
++++ b/shapes/area.go
+@@ -10,3 +10,3 @@ func Area(w, h int) int {
+ 	// Multiply the sides
+-	return w + h
++	return w * h
+ }
+`
+
+func writeTestRepo(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/repo\n\ngo 1.23\n",
+		"shapes/area.go": `package shapes
+
+import "fmt"
+
+const unrelated = 1
+
+// Area returns the area of a rectangle.
+// It is used by the printer.
+func Area(w, h int) int {
+	// Multiply the sides
+	return w * h
+}
+
+func Describe(w, h int) string {
+	return fmt.Sprintf("%d", Area(w, h))
+}
+`,
+		"shapes/square.go": `package shapes
+
+func Square(s int) int { return Area(s, s) }
+
+func unused() {}
+`,
+		"printer/printer.go": `package printer
+
+import geo "example.com/repo/shapes"
+
+func Print() int {
+	return geo.Area(1, 2)
+}
+
+func Other() int { return 0 }
+`,
+		"vendor/example.com/repo/shapes/copy.go": `package x
+
+import "example.com/repo/shapes"
+
+var _ = shapes.Area
+`,
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestChangedLines(t *testing.T) {
+	diff := testDiff + `diff --git a/gone.go b/gone.go
+--- a/gone.go
++++ /dev/null
+@@ -1,1 +0,0 @@
+-package gone
+diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,3 @@
+ package main
+-
+-// removed
+ func main() {}
+`
+	lines := ChangedLines(diff)
+	if got := lines["shapes/area.go"]; !slices.Equal(got, []int{11}) {
+		t.Errorf("Expected shapes/area.go line 11 to be changed, but got %v", got)
+	}
+	if got := lines["main.go"]; !slices.Equal(got, []int{2}) {
+		t.Errorf("Expected the deletion in main.go to be placed at line 2, but got %v", got)
+	}
+	if _, ok := lines["gone.go"]; ok {
+		t.Errorf("Expected deleted files to have no changed lines, but got %v", lines["gone.go"])
+	}
+}
+
+func TestChangedLinesHeaderLikeContent(t *testing.T) {
+	// A removed "-- comment" line and an added "++ counter" line look like file headers
+	diff := "diff --git a/query.sql b/query.sql\n--- a/query.sql\n+++ b/query.sql\n@@ -1,3 +1,3 @@\n" +
+		" SELECT 1;\n--- old comment\n+++ new comment\n SELECT 2;\n"
+	lines := ChangedLines(diff)
+	if got := lines["query.sql"]; !slices.Equal(got, []int{2}) {
+		t.Errorf("Expected query.sql line 2 to be changed, but got %v", lines)
+	}
+	if len(lines) != 1 {
+		t.Errorf("Expected only query.sql to be changed, but got %v", lines)
+	}
+}
+
+func TestGather(t *testing.T) {
+	root := writeTestRepo(t)
+	ctx, err := Gather(root, testDiff, Options{Budget: 10000, MaxReferences: 5})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	var got []string
+	for _, s := range ctx.Snippets {
+		got = append(got, s.Path+" "+s.Reason)
+	}
+	want := []string{
+		"shapes/area.go enclosing a change",
+		"shapes/area.go references Area",
+		"shapes/square.go references Area",
+		"printer/printer.go references Area",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("Expected snippets %v, but got %v", want, got)
+	}
+	if !strings.HasPrefix(ctx.Snippets[0].Code, "// Area returns") || ctx.Snippets[0].StartLine != 7 || ctx.Snippets[0].EndLine != 12 {
+		t.Errorf("Expected the whole Area declaration with its doc comment, but got lines %d-%d:\n%s", ctx.Snippets[0].StartLine, ctx.Snippets[0].EndLine, ctx.Snippets[0].Code)
+	}
+	if ctx.Snippets[3].Code != "func Print() int {\n\treturn geo.Area(1, 2)\n}" {
+		t.Errorf("Expected the Print function referencing Area, but got %q", ctx.Snippets[3].Code)
+	}
+	if ctx.Omitted != 0 {
+		t.Errorf("Expected nothing to be omitted, but got %d", ctx.Omitted)
+	}
+}
+
+func TestGather_Budget(t *testing.T) {
+	root := writeTestRepo(t)
+	ctx, err := Gather(root, testDiff, Options{Budget: 150, MaxReferences: 1})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(ctx.Snippets) != 1 || ctx.Snippets[0].Reason != "enclosing a change" {
+		t.Fatalf("Expected only the changed declaration to fit, but got %+v", ctx.Snippets)
+	}
+	if ctx.Omitted != 1 {
+		t.Errorf("Expected one reference to be omitted, but got %d", ctx.Omitted)
+	}
+	if !strings.Contains(ctx.String(), "1 more declarations were left out") {
+		t.Errorf("Expected the rendered context to mention the omitted declaration, but got:\n%s", ctx.String())
+	}
+}
+
+func TestGather_Withholds(t *testing.T) {
+	root := writeTestRepo(t)
+	ctx, err := Gather(root, testDiff, Options{Budget: 10000, MaxReferences: 5, Withholds: func(path string) bool {
+		return path != "shapes/area.go"
+	}})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	for _, s := range ctx.Snippets {
+		if s.Path != "shapes/area.go" {
+			t.Errorf("Expected withheld files to be left out, but got a snippet from %s", s.Path)
+		}
+	}
+	if len(ctx.Snippets) == 0 || ctx.Omitted != 0 {
+		t.Errorf("Expected the changed declaration and no omissions, but got %+v", ctx)
+	}
+}
+
+func TestGather_NonGo(t *testing.T) {
+	diff := "diff --git a/README.md b/README.md\n--- a/README.md\n+++ b/README.md\n@@ -1 +1 @@\n-a\n+b\n"
+	ctx, err := Gather(t.TempDir(), diff, Options{Budget: 1000, MaxReferences: 5})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if ctx.String() != "" {
+		t.Errorf("Expected no context for non Go changes, but got %q", ctx.String())
+	}
+}
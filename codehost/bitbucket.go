@@ -0,0 +1,227 @@
+package codehost
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// BitbucketServer posts reviews to Bitbucket Server / Data Center pull requests.
+type BitbucketServer struct {
+	// BaseURL is the server root, e.g. https://bitbucket.example.com
+	BaseURL    string
+	Token      string
+	Project    string
+	Repo       string
+	PRNumber   int
+	HTTPClient *http.Client
+
+	rest *restClient
+	// login is the user of the token, see self
+	login string
+}
+
+type bitbucketRef struct {
+	DisplayID    string `json:"displayId"`
+	LatestCommit string `json:"latestCommit"`
+}
+
+type bitbucketPR struct {
+	ID          int          `json:"id"`
+	Version     int          `json:"version"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Draft       bool         `json:"draft"`
+	FromRef     bitbucketRef `json:"fromRef"`
+	ToRef       bitbucketRef `json:"toRef"`
+	Author      struct {
+		User struct {
+			Name string `json:"name"`
+		} `json:"user"`
+	} `json:"author"`
+}
+
+type bitbucketComment struct {
+	ID      int64  `json:"id"`
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+	Author  struct {
+		Name string `json:"name"`
+	} `json:"author"`
+}
+
+type bitbucketActivities struct {
+	IsLastPage    bool `json:"isLastPage"`
+	NextPageStart int  `json:"nextPageStart"`
+	Values        []struct {
+		Action  string            `json:"action"`
+		Comment *bitbucketComment `json:"comment"`
+	} `json:"values"`
+}
+
+func (b *BitbucketServer) client() *restClient {
+	if b.rest == nil {
+		b.rest = newRestClient(b.BaseURL+"/rest/api/1.0", b.HTTPClient, func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+b.Token)
+		})
+	}
+	return b.rest
+}
+
+func (b *BitbucketServer) prPath(number int) string {
+	return fmt.Sprintf("/projects/%s/repos/%s/pull-requests/%d", b.Project, b.Repo, number)
+}
+
+func (b *BitbucketServer) checkRepo() error {
+	if b.BaseURL == "" {
+		return fmt.Errorf("bitbucket base URL is not set")
+	}
+	if b.Project == "" || b.Repo == "" {
+		return fmt.Errorf("bitbucket repository is not set, expected PROJECT/repo")
+	}
+	return nil
+}
+
+func (b *BitbucketServer) getPR(ctx context.Context, number int) (*bitbucketPR, error) {
+	if err := b.checkRepo(); err != nil {
+		return nil, err
+	}
+	var pr bitbucketPR
+	if _, err := b.client().do(ctx, http.MethodGet, b.prPath(number), nil, &pr); err != nil {
+		return nil, fmt.Errorf("unable to get pr. err: %w", err)
+	}
+	return &pr, nil
+}
+
+func (b *BitbucketServer) GetPRInfo(ctx context.Context) (*PRInfo, error) {
+	if b.PRNumber == 0 || b.Token == "" {
+		return nil, nil
+	}
+	pr, err := b.getPR(ctx, b.PRNumber)
+	if err != nil {
+		return nil, err
+	}
+	return &PRInfo{
+		Number:  pr.ID,
+		Title:   pr.Title,
+		Body:    pr.Description,
+		BaseRef: pr.ToRef.DisplayID,
+		BaseSHA: pr.ToRef.LatestCommit,
+		HeadSHA: pr.FromRef.LatestCommit,
+		Draft:   pr.Draft,
+		Author:  pr.Author.User.Name,
+	}, nil
+}
+
+func (b *BitbucketServer) FindComment(ctx context.Context, pr *PRInfo, tag string) (string, error) {
+	existing, err := b.findComment(ctx, pr, tag)
+	if err != nil || existing == nil {
+		return "", err
+	}
+	return existing.Text, nil
+}
+
+func (b *BitbucketServer) findComment(ctx context.Context, pr *PRInfo, tag string) (*bitbucketComment, error) {
+	if err := b.checkRepo(); err != nil {
+		return nil, err
+	}
+
+	login, err := b.self(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for start := 0; ; {
+		var activities bitbucketActivities
+		path := fmt.Sprintf("%s/activities?limit=100&start=%d", b.prPath(pr.Number), start)
+		if _, err := b.client().do(ctx, http.MethodGet, path, nil, &activities); err != nil {
+			return nil, fmt.Errorf("failed to list comments on PR, err: %w", err)
+		}
+		for _, a := range activities.Values {
+			if a.Action == "COMMENTED" && a.Comment != nil && a.Comment.Author.Name == login && strings.Contains(a.Comment.Text, tag) {
+				return a.Comment, nil
+			}
+		}
+		if activities.IsLastPage {
+			return nil, nil
+		}
+		start = activities.NextPageStart
+	}
+}
+
+// self returns the user of the token, which the comments are written as. Bitbucket Server names the user of
+// authenticated requests in the X-AUSERNAME response header.
+func (b *BitbucketServer) self(ctx context.Context) (string, error) {
+	if b.login == "" {
+		resp, err := b.client().do(ctx, http.MethodGet, "/application-properties", nil, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up the user of the Bitbucket token: %w", err)
+		}
+		b.login = resp.Header.Get("X-AUSERNAME")
+		if b.login == "" {
+			return "", fmt.Errorf("failed to look up the user of the Bitbucket token: no X-AUSERNAME header")
+		}
+	}
+	return b.login, nil
+}
+
+func (b *BitbucketServer) UpsertComment(ctx context.Context, pr *PRInfo, tag, body string) (string, error) {
+	existing, err := b.findComment(ctx, pr, tag)
+	if err != nil {
+		return "", err
+	}
+
+	var comment bitbucketComment
+	if existing != nil {
+		path := fmt.Sprintf("%s/comments/%d", b.prPath(pr.Number), existing.ID)
+		req := map[string]any{"text": body, "version": existing.Version}
+		if _, err := b.client().do(ctx, http.MethodPut, path, req, &comment); err != nil {
+			return "", fmt.Errorf("failed to update comment on PR, err: %w", err)
+		}
+	} else {
+		if _, err := b.client().do(ctx, http.MethodPost, b.prPath(pr.Number)+"/comments", map[string]any{"text": body}, &comment); err != nil {
+			return "", fmt.Errorf("failed to create comment on PR, err: %w", err)
+		}
+	}
+	return fmt.Sprintf("%s%s/overview?commentId=%d", b.BaseURL, b.prPath(pr.Number), comment.ID), nil
+}
+
+func (b *BitbucketServer) PostInlineComments(ctx context.Context, pr *PRInfo, comments []InlineComment) error {
+	if err := b.checkRepo(); err != nil {
+		return err
+	}
+	for _, c := range comments {
+		req := map[string]any{
+			"text": c.Body,
+			"anchor": map[string]any{
+				"path":     c.Path,
+				"line":     c.Line,
+				"lineType": "ADDED",
+				"fileType": "TO",
+				"diffType": "EFFECTIVE",
+			},
+		}
+		if _, err := b.client().do(ctx, http.MethodPost, b.prPath(pr.Number)+"/comments", req, nil); err != nil {
+			return fmt.Errorf("failed to create comment on %s:%d, err: %w", c.Path, c.Line, err)
+		}
+	}
+	return nil
+}
+
+func (b *BitbucketServer) UpdateDescription(ctx context.Context, pr *PRInfo, body string) error {
+	// Edits must carry the current version of the pull request
+	current, err := b.getPR(ctx, pr.Number)
+	if err != nil {
+		return err
+	}
+	req := map[string]any{
+		"version":     current.Version,
+		"title":       current.Title,
+		"description": body,
+	}
+	if _, err := b.client().do(ctx, http.MethodPut, b.prPath(pr.Number), req, nil); err != nil {
+		return fmt.Errorf("failed to update PR description, err: %w", err)
+	}
+	return nil
+}
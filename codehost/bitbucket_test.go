@@ -0,0 +1,182 @@
+package codehost
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+type stubBitbucket struct {
+	comments    []bitbucketComment
+	inline      []map[string]any
+	description string
+	version     int
+}
+
+func newStubBitbucket(t *testing.T) (*stubBitbucket, *httptest.Server) {
+	s := &stubBitbucket{version: 4}
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}
+	readJSON := func(r *http.Request, v any) {
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+	}
+	const prPath = "/rest/api/1.0/projects/PROJ/repos/repo/pull-requests/9"
+
+	mux.HandleFunc("GET "+prPath, func(w http.ResponseWriter, r *http.Request) {
+		pr := bitbucketPR{
+			ID:          9,
+			Version:     s.version,
+			Title:       "Add Bitbucket",
+			Description: s.description,
+			FromRef:     bitbucketRef{DisplayID: "feature", LatestCommit: "head456"},
+			ToRef:       bitbucketRef{DisplayID: "main", LatestCommit: "base123"},
+		}
+		pr.Author.User.Name = "jdoe"
+		writeJSON(w, pr)
+	})
+	mux.HandleFunc("PUT "+prPath, func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		readJSON(r, &req)
+		if req["version"] != float64(s.version) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		s.description = req["description"].(string)
+		s.version++
+		writeJSON(w, map[string]any{"id": 9})
+	})
+	mux.HandleFunc("GET /rest/api/1.0/application-properties", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-AUSERNAME", "neuro-bot")
+		writeJSON(w, map[string]any{"displayName": "Bitbucket"})
+	})
+	mux.HandleFunc("GET "+prPath+"/activities", func(w http.ResponseWriter, r *http.Request) {
+		var act bitbucketActivities
+		act.IsLastPage = true
+		for i := range s.comments {
+			act.Values = append(act.Values, struct {
+				Action  string            `json:"action"`
+				Comment *bitbucketComment `json:"comment"`
+			}{Action: "COMMENTED", Comment: &s.comments[i]})
+		}
+		writeJSON(w, act)
+	})
+	mux.HandleFunc("POST "+prPath+"/comments", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		readJSON(r, &req)
+		if _, ok := req["anchor"]; ok {
+			s.inline = append(s.inline, req)
+			writeJSON(w, map[string]any{"id": 100})
+			return
+		}
+		c := newBitbucketComment(int64(len(s.comments)+1), "neuro-bot", req["text"].(string))
+		s.comments = append(s.comments, c)
+		writeJSON(w, c)
+	})
+	mux.HandleFunc("PUT "+prPath+"/comments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		readJSON(r, &req)
+		id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		for i := range s.comments {
+			if s.comments[i].ID == id {
+				s.comments[i].Text = req["text"].(string)
+				s.comments[i].Version++
+				writeJSON(w, s.comments[i])
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	return s, server
+}
+
+func newTestBitbucket(url string) *BitbucketServer {
+	return &BitbucketServer{BaseURL: url, Token: "test_token", Project: "PROJ", Repo: "repo", PRNumber: 9}
+}
+
+func TestBitbucketServer_GetPRInfo(t *testing.T) {
+	_, server := newStubBitbucket(t)
+	defer server.Close()
+
+	pr, err := newTestBitbucket(server.URL).GetPRInfo(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if pr.Number != 9 || pr.Title != "Add Bitbucket" || pr.BaseSHA != "base123" || pr.HeadSHA != "head456" || pr.BaseRef != "main" {
+		t.Errorf("Unexpected PR info: %+v", pr)
+	}
+	if pr.Author != "jdoe" {
+		t.Errorf("Expected author jdoe, but got %q", pr.Author)
+	}
+}
+
+func TestBitbucketServer_UpsertComment(t *testing.T) {
+	stub, server := newStubBitbucket(t)
+	defer server.Close()
+	const tag = "# NeuroSpecation AI Review\n"
+	// Anyone can write a comment with the tag, only the token user's comments count
+	stub.comments = []bitbucketComment{newBitbucketComment(1, "dev", "lgtm"), newBitbucketComment(2, "dev", tag+"imposter")}
+
+	b := newTestBitbucket(server.URL)
+	pr := &PRInfo{Number: 9}
+	if body, err := b.FindComment(context.Background(), pr, tag); err != nil || body != "" {
+		t.Fatalf("Expected no tagged comment, but got %q, err: %v", body, err)
+	}
+	for _, body := range []string{"first", "second"} {
+		if _, err := b.UpsertComment(context.Background(), pr, tag, tag+body); err != nil {
+			t.Fatalf("Expected no error, but got: %v", err)
+		}
+	}
+	if len(stub.comments) != 3 || stub.comments[2].Text != tag+"second" || stub.comments[1].Text != tag+"imposter" {
+		t.Errorf("Expected a single tagged comment to be created then updated, but got %+v", stub.comments)
+	}
+}
+
+func newBitbucketComment(id int64, author, text string) bitbucketComment {
+	c := bitbucketComment{ID: id, Text: text}
+	c.Author.Name = author
+	return c
+}
+
+func TestBitbucketServer_PostInlineCommentsAndDescription(t *testing.T) {
+	stub, server := newStubBitbucket(t)
+	defer server.Close()
+
+	b := newTestBitbucket(server.URL)
+	pr := &PRInfo{Number: 9}
+	err := b.PostInlineComments(context.Background(), pr, []InlineComment{{Path: "main.go", Line: 4, Body: "nit"}})
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if len(stub.inline) != 1 {
+		t.Fatalf("Expected 1 inline comment, but got %d", len(stub.inline))
+	}
+	anchor := stub.inline[0]["anchor"].(map[string]any)
+	if anchor["path"] != "main.go" || anchor["line"] != float64(4) || anchor["lineType"] != "ADDED" {
+		t.Errorf("Unexpected anchor: %v", anchor)
+	}
+
+	if err := b.UpdateDescription(context.Background(), pr, "described"); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if stub.description != "described" {
+		t.Errorf("Expected description to be updated, but got %q", stub.description)
+	}
+}
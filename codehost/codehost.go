@@ -0,0 +1,118 @@
+// Package codehost abstracts the code hosting platforms (GitHub, GitLab, ...) that pull request reviews are posted to.
+package codehost
+
+import (
+	"context"
+)
+
+// PRInfo holds the pull request (or merge request) metadata needed to review a change.
+type PRInfo struct {
+	Number  int
+	Title   string
+	Body    string
+	BaseRef string
+	BaseSHA string
+	HeadSHA string
+	Draft   bool
+	Labels  []string
+	// Author is the login of the pull request author, if known
+	Author string
+}
+
+// InlineComment is a review comment anchored to a line on the new side of the diff.
+type InlineComment struct {
+	Path string
+	// StartLine is set for comments spanning StartLine..Line, hosts without multi-line comments anchor to Line
+	StartLine int
+	Line      int
+	Body      string
+}
+
+// Host is a code hosting platform that pull request reviews can be read from and written to.
+type Host interface {
+	// GetPRInfo returns the pull request being reviewed, or nil when not running against a pull request.
+	GetPRInfo(ctx context.Context) (*PRInfo, error)
+	// FindComment returns the body of the first comment containing tag that the host's own account wrote, or "" if
+	// there is none. Comments by anyone else are ignored, they could imitate the tag.
+	FindComment(ctx context.Context, pr *PRInfo, tag string) (string, error)
+	// UpsertComment updates the first comment containing tag that the host's own account wrote, or creates a new one,
+	// and returns its URL.
+	UpsertComment(ctx context.Context, pr *PRInfo, tag, body string) (string, error)
+	// PostInlineComments posts comments against individual lines of the diff.
+	PostInlineComments(ctx context.Context, pr *PRInfo, comments []InlineComment) error
+	// UpdateDescription replaces the pull request description.
+	UpdateDescription(ctx context.Context, pr *PRInfo, body string) error
+}
+
+// Check is a completed status check with per-line annotations.
+type Check struct {
+	Name    string
+	Title   string
+	Summary string
+	// Conclusion is one of success, neutral or failure
+	Conclusion  string
+	Annotations []Annotation
+}
+
+// Annotation levels, as used by GitHub check runs.
+const (
+	AnnotationNotice  = "notice"
+	AnnotationWarning = "warning"
+	AnnotationFailure = "failure"
+)
+
+// Annotation marks a range of lines in a file with a message.
+type Annotation struct {
+	Path      string
+	StartLine int
+	EndLine   int
+	Level     string
+	Title     string
+	Message   string
+}
+
+// CheckPublisher is implemented by hosts that can report a review as a status check.
+type CheckPublisher interface {
+	// PublishCheck creates a completed check against the head commit and returns its URL.
+	PublishCheck(ctx context.Context, pr *PRInfo, check Check) (string, error)
+}
+
+// Comment is a pull request comment, either on the conversation or in a review thread on a file.
+type Comment struct {
+	ID     int64
+	Author string
+	// AuthorAssociation is the author's relation to the repository, e.g. OWNER, MEMBER or CONTRIBUTOR
+	AuthorAssociation string
+	Body              string
+	// Path, Line and DiffHunk are set for review thread comments
+	Path     string
+	Line     int
+	DiffHunk string
+	// InReplyTo is the first comment of the review thread, 0 if this comment started it
+	InReplyTo int64
+}
+
+// IsReviewComment reports whether the comment is part of a review thread on a file.
+func (c *Comment) IsReviewComment() bool {
+	return c.Path != ""
+}
+
+// ConversationHost is implemented by hosts that can answer comments in pull request threads.
+type ConversationHost interface {
+	// TriggerComment returns the comment that triggered this run, or nil if the run was not triggered by a comment.
+	TriggerComment(ctx context.Context) (*Comment, error)
+	// Thread returns the comments of the thread that c belongs to, oldest first.
+	Thread(ctx context.Context, pr *PRInfo, c *Comment) ([]Comment, error)
+	// Reply answers in the thread of c and returns the URL of the reply.
+	Reply(ctx context.Context, pr *PRInfo, c *Comment, body string) (string, error)
+}
+
+// Triager is implemented by hosts that can label pull requests and request reviewers.
+type Triager interface {
+	// RepoLabels returns the names of the labels defined in the repository.
+	RepoLabels(ctx context.Context) ([]string, error)
+	// AddLabels adds labels to the pull request, keeping its existing labels.
+	AddLabels(ctx context.Context, pr *PRInfo, labels []string) error
+	// RequestReviewers requests reviews from users, and from teams given as "org/team".
+	RequestReviewers(ctx context.Context, pr *PRInfo, reviewers []string) error
+}
@@ -0,0 +1,234 @@
+package codehost
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Gitea posts reviews to Gitea and Forgejo pull requests.
+type Gitea struct {
+	// BaseURL is the server root, e.g. https://gitea.example.com
+	BaseURL    string
+	Token      string
+	Owner      string
+	Repo       string
+	PRNumber   int
+	HTTPClient *http.Client
+
+	// EventName and EventPath are set by Gitea/Forgejo Actions, which use the GitHub event format
+	EventName string
+	EventPath string
+
+	rest *restClient
+	// login is the user of the token, see self
+	login string
+}
+
+type giteaPR struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	Draft  bool   `json:"draft"`
+	User   struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Base struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"base"`
+	Head struct {
+		SHA string `json:"sha"`
+	} `json:"head"`
+}
+
+type giteaComment struct {
+	ID      int64  `json:"id"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+	User    struct {
+		Login string `json:"login"`
+	} `json:"user"`
+}
+
+func (g *Gitea) client() *restClient {
+	if g.rest == nil {
+		g.rest = newRestClient(g.BaseURL+"/api/v1", g.HTTPClient, func(req *http.Request) {
+			req.Header.Set("Authorization", "token "+g.Token)
+		})
+	}
+	return g.rest
+}
+
+func (g *Gitea) repoPath() string {
+	return fmt.Sprintf("/repos/%s/%s", g.Owner, g.Repo)
+}
+
+func (g *Gitea) checkRepo() error {
+	if g.BaseURL == "" {
+		return fmt.Errorf("gitea base URL is not set")
+	}
+	if g.Owner == "" || g.Repo == "" {
+		return fmt.Errorf("gitea repository is not set, expected owner/repo")
+	}
+	return nil
+}
+
+func (g *Gitea) GetPRInfo(ctx context.Context) (*PRInfo, error) {
+	number := g.PRNumber
+	if number == 0 && g.EventPath != "" {
+		pr, err := ReadGitHubEvent(g.EventName, g.EventPath)
+		if err != nil {
+			return nil, err
+		}
+		if pr == nil {
+			return nil, nil
+		}
+		if g.Token == "" {
+			return pr, nil
+		}
+		number = pr.Number
+	}
+	if number == 0 || g.Token == "" {
+		return nil, nil
+	}
+	if err := g.checkRepo(); err != nil {
+		return nil, err
+	}
+
+	var pr giteaPR
+	if _, err := g.client().do(ctx, http.MethodGet, fmt.Sprintf("%s/pulls/%d", g.repoPath(), number), nil, &pr); err != nil {
+		return nil, fmt.Errorf("unable to get pr. err: %w", err)
+	}
+	var labels []string
+	for _, l := range pr.Labels {
+		labels = append(labels, l.Name)
+	}
+	return &PRInfo{
+		Number:  pr.Number,
+		Title:   pr.Title,
+		Body:    pr.Body,
+		BaseRef: pr.Base.Ref,
+		BaseSHA: pr.Base.SHA,
+		HeadSHA: pr.Head.SHA,
+		Draft:   pr.Draft || strings.HasPrefix(pr.Title, "WIP:"),
+		Author:  pr.User.Login,
+		Labels:  labels,
+	}, nil
+}
+
+func (g *Gitea) FindComment(ctx context.Context, pr *PRInfo, tag string) (string, error) {
+	existing, err := g.findComment(ctx, pr, tag)
+	if err != nil || existing == nil {
+		return "", err
+	}
+	return existing.Body, nil
+}
+
+func (g *Gitea) findComment(ctx context.Context, pr *PRInfo, tag string) (*giteaComment, error) {
+	if err := g.checkRepo(); err != nil {
+		return nil, err
+	}
+
+	login, err := g.self(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for page := 1; ; page++ {
+		var comments []giteaComment
+		path := fmt.Sprintf("%s/issues/%d/comments?limit=50&page=%d", g.repoPath(), pr.Number, page)
+		if _, err := g.client().do(ctx, http.MethodGet, path, nil, &comments); err != nil {
+			return nil, fmt.Errorf("failed to list comments on PR, err: %w", err)
+		}
+		if len(comments) == 0 {
+			return nil, nil
+		}
+		for i := range comments {
+			if comments[i].User.Login == login && strings.Contains(comments[i].Body, tag) {
+				return &comments[i], nil
+			}
+		}
+	}
+}
+
+// self returns the user of the token, which the comments are written as.
+func (g *Gitea) self(ctx context.Context) (string, error) {
+	if g.login == "" {
+		var user struct {
+			Login string `json:"login"`
+		}
+		if _, err := g.client().do(ctx, http.MethodGet, "/user", nil, &user); err != nil {
+			return "", fmt.Errorf("failed to look up the user of the Gitea token: %w", err)
+		}
+		g.login = user.Login
+	}
+	return g.login, nil
+}
+
+func (g *Gitea) UpsertComment(ctx context.Context, pr *PRInfo, tag, body string) (string, error) {
+	existing, err := g.findComment(ctx, pr, tag)
+	if err != nil {
+		return "", err
+	}
+
+	req := map[string]string{"body": body}
+	var comment giteaComment
+	if existing != nil {
+		path := fmt.Sprintf("%s/issues/comments/%d", g.repoPath(), existing.ID)
+		if _, err := g.client().do(ctx, http.MethodPatch, path, req, &comment); err != nil {
+			return "", fmt.Errorf("failed to update comment on PR, err: %w", err)
+		}
+	} else {
+		path := fmt.Sprintf("%s/issues/%d/comments", g.repoPath(), pr.Number)
+		if _, err := g.client().do(ctx, http.MethodPost, path, req, &comment); err != nil {
+			return "", fmt.Errorf("failed to create comment on PR, err: %w", err)
+		}
+	}
+	return comment.HTMLURL, nil
+}
+
+func (g *Gitea) PostInlineComments(ctx context.Context, pr *PRInfo, comments []InlineComment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	if err := g.checkRepo(); err != nil {
+		return err
+	}
+
+	var reviewComments []map[string]any
+	for _, c := range comments {
+		reviewComments = append(reviewComments, map[string]any{
+			"path":         c.Path,
+			"new_position": c.Line,
+			"body":         c.Body,
+		})
+	}
+	req := map[string]any{
+		"event":    "COMMENT",
+		"comments": reviewComments,
+	}
+	if pr.HeadSHA != "" {
+		req["commit_id"] = pr.HeadSHA
+	}
+	path := fmt.Sprintf("%s/pulls/%d/reviews", g.repoPath(), pr.Number)
+	if _, err := g.client().do(ctx, http.MethodPost, path, req, nil); err != nil {
+		return fmt.Errorf("failed to create PR review comments, err: %w", err)
+	}
+	return nil
+}
+
+func (g *Gitea) UpdateDescription(ctx context.Context, pr *PRInfo, body string) error {
+	if err := g.checkRepo(); err != nil {
+		return err
+	}
+	path := fmt.Sprintf("%s/pulls/%d", g.repoPath(), pr.Number)
+	if _, err := g.client().do(ctx, http.MethodPatch, path, map[string]string{"body": body}, nil); err != nil {
+		return fmt.Errorf("failed to update PR description, err: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package codehost
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+type stubGitea struct {
+	comments    []giteaComment
+	reviews     []map[string]any
+	description string
+}
+
+func newStubGitea(t *testing.T) (*stubGitea, *httptest.Server) {
+	s := &stubGitea{}
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}
+	readJSON := func(r *http.Request, v any) {
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+	}
+
+	mux.HandleFunc("GET /api/v1/repos/owner/repo/pulls/3", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"number": 3,
+			"title":  "Add Gitea",
+			"body":   s.description,
+			"user":   map[string]string{"login": "gitea-user"},
+			"labels": []map[string]string{{"name": "enhancement"}},
+			"base":   map[string]string{"ref": "main", "sha": "base123"},
+			"head":   map[string]string{"sha": "head456"},
+		})
+	})
+	mux.HandleFunc("PATCH /api/v1/repos/owner/repo/pulls/3", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		readJSON(r, &req)
+		s.description = req["body"]
+		writeJSON(w, map[string]any{"number": 3})
+	})
+	mux.HandleFunc("GET /api/v1/user", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"login": "neuro-bot"})
+	})
+	mux.HandleFunc("GET /api/v1/repos/owner/repo/issues/3/comments", func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page != 1 {
+			writeJSON(w, []giteaComment{})
+			return
+		}
+		writeJSON(w, s.comments)
+	})
+	mux.HandleFunc("POST /api/v1/repos/owner/repo/issues/3/comments", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		readJSON(r, &req)
+		c := newGiteaComment(int64(len(s.comments)+1), "neuro-bot", req["body"])
+		c.HTMLURL = "https://gitea/c"
+		s.comments = append(s.comments, c)
+		writeJSON(w, c)
+	})
+	mux.HandleFunc("PATCH /api/v1/repos/owner/repo/issues/comments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		readJSON(r, &req)
+		id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		for i := range s.comments {
+			if s.comments[i].ID == id {
+				s.comments[i].Body = req["body"]
+				writeJSON(w, s.comments[i])
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("POST /api/v1/repos/owner/repo/pulls/3/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		readJSON(r, &req)
+		s.reviews = append(s.reviews, req)
+		writeJSON(w, map[string]any{"id": 1})
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token test_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	return s, server
+}
+
+func newTestGitea(url string) *Gitea {
+	return &Gitea{BaseURL: url, Token: "test_token", Owner: "owner", Repo: "repo", PRNumber: 3}
+}
+
+func TestGitea_GetPRInfo(t *testing.T) {
+	stub, server := newStubGitea(t)
+	defer server.Close()
+	stub.description = "body"
+
+	pr, err := newTestGitea(server.URL).GetPRInfo(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if pr.Number != 3 || pr.Title != "Add Gitea" || pr.Body != "body" || pr.BaseSHA != "base123" || pr.HeadSHA != "head456" {
+		t.Errorf("Unexpected PR info: %+v", pr)
+	}
+	if len(pr.Labels) != 1 || pr.Labels[0] != "enhancement" {
+		t.Errorf("Expected labels [enhancement], but got %v", pr.Labels)
+	}
+	if pr.Author != "gitea-user" {
+		t.Errorf("Expected author gitea-user, but got %q", pr.Author)
+	}
+}
+
+func TestGitea_UpsertComment(t *testing.T) {
+	stub, server := newStubGitea(t)
+	defer server.Close()
+	const tag = "# NeuroSpecation AI Review\n"
+	// Anyone can write a comment with the tag, only the token user's comments count
+	stub.comments = []giteaComment{newGiteaComment(1, "dev", "lgtm"), newGiteaComment(2, "dev", tag+"imposter")}
+
+	g := newTestGitea(server.URL)
+	pr := &PRInfo{Number: 3}
+	if body, err := g.FindComment(context.Background(), pr, tag); err != nil || body != "" {
+		t.Fatalf("Expected no tagged comment, but got %q, err: %v", body, err)
+	}
+	for _, body := range []string{"first", "second"} {
+		if _, err := g.UpsertComment(context.Background(), pr, tag, tag+body); err != nil {
+			t.Fatalf("Expected no error, but got: %v", err)
+		}
+	}
+	if len(stub.comments) != 3 || stub.comments[2].Body != tag+"second" || stub.comments[1].Body != tag+"imposter" {
+		t.Errorf("Expected a single tagged comment to be created then updated, but got %+v", stub.comments)
+	}
+}
+
+func newGiteaComment(id int64, author, body string) giteaComment {
+	c := giteaComment{ID: id, Body: body}
+	c.User.Login = author
+	return c
+}
+
+func TestGitea_PostInlineCommentsAndDescription(t *testing.T) {
+	stub, server := newStubGitea(t)
+	defer server.Close()
+
+	g := newTestGitea(server.URL)
+	pr := &PRInfo{Number: 3, HeadSHA: "head456"}
+	err := g.PostInlineComments(context.Background(), pr, []InlineComment{{Path: "main.go", Line: 4, Body: "nit"}})
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if len(stub.reviews) != 1 || stub.reviews[0]["commit_id"] != "head456" {
+		t.Fatalf("Expected a review on the head commit, but got %+v", stub.reviews)
+	}
+	c := stub.reviews[0]["comments"].([]any)[0].(map[string]any)
+	if c["path"] != "main.go" || c["new_position"] != float64(4) {
+		t.Errorf("Unexpected review comment: %v", c)
+	}
+
+	if err := g.UpdateDescription(context.Background(), pr, "described"); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if stub.description != "described" {
+		t.Errorf("Expected description to be updated, but got %q", stub.description)
+	}
+}
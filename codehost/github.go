@@ -0,0 +1,288 @@
+package codehost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/go-github/v69/github"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GitHub posts reviews to GitHub pull requests.
+type GitHub struct {
+	Client    *github.Client
+	Owner     string
+	Repo      string
+	Token     string
+	EventName string
+	EventPath string
+	// PRNumber is used when no event payload is available
+	PRNumber int
+	// Login is the account the token writes comments as, looked up when empty
+	Login string
+}
+
+// actionsBotLogin is the account the GitHub Actions token writes comments as.
+const actionsBotLogin = "github-actions[bot]"
+
+// NewGitHubFromEnv configures a GitHub host from the GitHub Actions environment variables.
+func NewGitHubFromEnv() (*GitHub, error) {
+	gh := &GitHub{
+		Token:     os.Getenv("GITHUB_TOKEN"),
+		EventName: os.Getenv("GITHUB_EVENT_NAME"),
+		EventPath: os.Getenv("GITHUB_EVENT_PATH"),
+	}
+	gh.Client = github.NewClient(nil).WithAuthToken(gh.Token)
+
+	if repo := os.Getenv("GITHUB_REPOSITORY"); repo != "" {
+		ownerRepo := strings.Split(repo, "/")
+		if len(ownerRepo) != 2 {
+			return nil, fmt.Errorf("invalid GITHUB_REPOSITORY format, got %s", repo)
+		}
+		gh.Owner, gh.Repo = ownerRepo[0], ownerRepo[1]
+	}
+
+	if prNumber := os.Getenv("GITHUB_PR_NUMBER"); prNumber != "" {
+		prNum, err := strconv.Atoi(prNumber)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GITHUB_PR_NUMBER format, got %s: err: %w", prNumber, err)
+		}
+		gh.PRNumber = prNum
+	}
+	return gh, nil
+}
+
+func (gh *GitHub) checkRepo() error {
+	if gh.Owner == "" || gh.Repo == "" {
+		return fmt.Errorf("GITHUB_REPOSITORY environment variable is not set")
+	}
+	return nil
+}
+
+// GetPRInfo prefers the Actions event payload (GITHUB_EVENT_PATH), GITHUB_PR_NUMBER is kept as a fallback.
+func (gh *GitHub) GetPRInfo(ctx context.Context) (*PRInfo, error) {
+	if gh.EventPath != "" {
+		pr, err := ReadGitHubEvent(gh.EventName, gh.EventPath)
+		if err != nil {
+			return nil, err
+		}
+		if pr != nil {
+			if pr.BaseSHA == "" && gh.Token != "" {
+				// issue_comment events do not carry the commit SHAs
+				return gh.fetchPRInfo(ctx, pr.Number)
+			}
+			return pr, nil
+		}
+		slog.Debug("event is not for a pull request", "event", gh.EventName)
+	}
+
+	if gh.PRNumber == 0 || gh.Token == "" {
+		return nil, nil
+	}
+	return gh.fetchPRInfo(ctx, gh.PRNumber)
+}
+
+// ReadGitHubEvent parses an Actions event payload, returning nil if the event is not about a pull request.
+func ReadGitHubEvent(eventName, eventPath string) (*PRInfo, error) {
+	payload, err := os.ReadFile(eventPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GITHUB_EVENT_PATH %s: %w", eventPath, err)
+	}
+
+	switch eventName {
+	case "pull_request", "pull_request_target", "pull_request_review", "pull_request_review_comment":
+		var event struct {
+			PullRequest *github.PullRequest `json:"pull_request"`
+		}
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, fmt.Errorf("failed to parse %s event: %w", eventName, err)
+		}
+		if event.PullRequest == nil {
+			return nil, fmt.Errorf("expected %s event to contain a pull_request", eventName)
+		}
+		return prInfoFromPullRequest(event.PullRequest), nil
+	case "issue_comment":
+		var event github.IssueCommentEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, fmt.Errorf("failed to parse %s event: %w", eventName, err)
+		}
+		if event.Issue == nil || !event.Issue.IsPullRequest() {
+			return nil, nil
+		}
+		var labels []string
+		for _, l := range event.Issue.Labels {
+			labels = append(labels, l.GetName())
+		}
+		return &PRInfo{
+			Number: event.Issue.GetNumber(),
+			Title:  event.Issue.GetTitle(),
+			Body:   event.Issue.GetBody(),
+			Draft:  event.Issue.GetDraft(),
+			Labels: labels,
+			Author: event.Issue.GetUser().GetLogin(),
+		}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (gh *GitHub) fetchPRInfo(ctx context.Context, prNum int) (*PRInfo, error) {
+	if err := gh.checkRepo(); err != nil {
+		return nil, err
+	}
+
+	pr, _, err := gh.Client.PullRequests.Get(ctx, gh.Owner, gh.Repo, prNum)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get pr. err: %w", err)
+	}
+	if pr == nil {
+		return nil, fmt.Errorf("expected pr data to be not nil")
+	}
+	return prInfoFromPullRequest(pr), nil
+}
+
+func prInfoFromPullRequest(pr *github.PullRequest) *PRInfo {
+	var labels []string
+	for _, l := range pr.Labels {
+		labels = append(labels, l.GetName())
+	}
+	return &PRInfo{
+		Number:  pr.GetNumber(),
+		Title:   pr.GetTitle(),
+		Body:    pr.GetBody(),
+		BaseRef: pr.GetBase().GetRef(),
+		BaseSHA: pr.GetBase().GetSHA(),
+		HeadSHA: pr.GetHead().GetSHA(),
+		Draft:   pr.GetDraft(),
+		Labels:  labels,
+		Author:  pr.GetUser().GetLogin(),
+	}
+}
+
+func (gh *GitHub) FindComment(ctx context.Context, pr *PRInfo, tag string) (string, error) {
+	existing, err := gh.findComment(ctx, pr, tag)
+	if err != nil {
+		return "", err
+	}
+	return existing.GetBody(), nil
+}
+
+func (gh *GitHub) findComment(ctx context.Context, pr *PRInfo, tag string) (*github.IssueComment, error) {
+	if err := gh.checkRepo(); err != nil {
+		return nil, err
+	}
+
+	login, err := gh.self(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := gh.Client.Issues.ListComments(ctx, gh.Owner, gh.Repo, pr.Number, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list comments on PR, err: %w", err)
+		}
+		for _, c := range comments {
+			if strings.EqualFold(c.GetUser().GetLogin(), login) && strings.Contains(c.GetBody(), tag) {
+				return c, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// self returns the account the token writes comments as. Installation tokens, the Actions token included, cannot look
+// up a user: the Actions token writes as github-actions[bot], GitHub Apps set Login to their own bot account.
+func (gh *GitHub) self(ctx context.Context) (string, error) {
+	if gh.Login != "" {
+		return gh.Login, nil
+	}
+	user, resp, err := gh.Client.Users.Get(ctx, "")
+	switch {
+	case err == nil:
+		gh.Login = user.GetLogin()
+	case resp != nil && resp.StatusCode == http.StatusForbidden:
+		gh.Login = actionsBotLogin
+	default:
+		return "", fmt.Errorf("failed to look up the user of the GitHub token: %w", err)
+	}
+	slog.Debug("Matching comments written by", "login", gh.Login)
+	return gh.Login, nil
+}
+
+func (gh *GitHub) UpsertComment(ctx context.Context, pr *PRInfo, tag, body string) (string, error) {
+	// Find existing comments and update the first one if it exists
+	existing, err := gh.findComment(ctx, pr, tag)
+	if err != nil {
+		return "", err
+	}
+
+	if existing != nil {
+		// Update the existing comment
+		c, _, err := gh.Client.Issues.EditComment(ctx, gh.Owner, gh.Repo, existing.GetID(), &github.IssueComment{Body: &body})
+		if err != nil {
+			return "", fmt.Errorf("failed to update comment on PR, err: %w", err)
+		}
+		return c.GetHTMLURL(), nil
+	}
+
+	// Create a new comment if no existing comment is found
+	c, _, err := gh.Client.Issues.CreateComment(ctx, gh.Owner, gh.Repo, pr.Number, &github.IssueComment{Body: &body})
+	if err != nil {
+		return "", fmt.Errorf("failed to create comment on PR, err: %w", err)
+	}
+	return c.GetHTMLURL(), nil
+}
+
+func (gh *GitHub) PostInlineComments(ctx context.Context, pr *PRInfo, comments []InlineComment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	if err := gh.checkRepo(); err != nil {
+		return err
+	}
+
+	review := &github.PullRequestReviewRequest{
+		Event: github.Ptr("COMMENT"),
+	}
+	if pr.HeadSHA != "" {
+		review.CommitID = github.Ptr(pr.HeadSHA)
+	}
+	for _, c := range comments {
+		comment := &github.DraftReviewComment{
+			Path: github.Ptr(c.Path),
+			Line: github.Ptr(c.Line),
+			Side: github.Ptr("RIGHT"),
+			Body: github.Ptr(c.Body),
+		}
+		if c.StartLine > 0 && c.StartLine < c.Line {
+			comment.StartLine = github.Ptr(c.StartLine)
+			comment.StartSide = github.Ptr("RIGHT")
+		}
+		review.Comments = append(review.Comments, comment)
+	}
+	_, _, err := gh.Client.PullRequests.CreateReview(ctx, gh.Owner, gh.Repo, pr.Number, review)
+	if err != nil {
+		return fmt.Errorf("failed to create PR review comments, err: %w", err)
+	}
+	return nil
+}
+
+func (gh *GitHub) UpdateDescription(ctx context.Context, pr *PRInfo, body string) error {
+	if err := gh.checkRepo(); err != nil {
+		return err
+	}
+	_, _, err := gh.Client.PullRequests.Edit(ctx, gh.Owner, gh.Repo, pr.Number, &github.PullRequest{Body: github.Ptr(body)})
+	if err != nil {
+		return fmt.Errorf("failed to update PR description, err: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package codehost
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v69/github"
+)
+
+func writeEvent(t *testing.T, payload string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "event.json")
+	if err := os.WriteFile(path, []byte(payload), 0644); err != nil {
+		t.Fatalf("Failed to write event file: %v", err)
+	}
+	return path
+}
+
+func TestReadGitHubEvent_PullRequest(t *testing.T) {
+	path := writeEvent(t, `{
+		"action": "opened",
+		"number": 42,
+		"pull_request": {
+			"number": 42,
+			"title": "Add feature",
+			"body": "Some body",
+			"draft": true,
+			"labels": [{"name": "bug"}, {"name": "docs"}],
+			"base": {"ref": "main", "sha": "aaa111"},
+			"head": {"ref": "feature", "sha": "bbb222"}
+		}
+	}`)
+
+	for _, eventName := range []string{"pull_request", "pull_request_target"} {
+		pr, err := ReadGitHubEvent(eventName, path)
+		if err != nil {
+			t.Fatalf("Expected no error, but got: %v", err)
+		}
+		if pr == nil {
+			t.Fatal("Expected PR info, but got nil")
+		}
+		if pr.Number != 42 || pr.Title != "Add feature" || pr.Body != "Some body" || !pr.Draft {
+			t.Errorf("Unexpected PR info: %+v", pr)
+		}
+		if pr.BaseSHA != "aaa111" || pr.HeadSHA != "bbb222" || pr.BaseRef != "main" {
+			t.Errorf("Unexpected PR refs: %+v", pr)
+		}
+		if len(pr.Labels) != 2 || pr.Labels[0] != "bug" || pr.Labels[1] != "docs" {
+			t.Errorf("Expected labels [bug docs], but got %v", pr.Labels)
+		}
+	}
+}
+
+func TestReadGitHubEvent_IssueComment(t *testing.T) {
+	path := writeEvent(t, `{
+		"action": "created",
+		"issue": {
+			"number": 7,
+			"title": "Fix typo",
+			"body": "",
+			"pull_request": {"url": "https://api.github.com/repos/o/r/pulls/7"}
+		},
+		"comment": {"body": "hello"}
+	}`)
+	pr, err := ReadGitHubEvent("issue_comment", path)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if pr == nil || pr.Number != 7 || pr.Title != "Fix typo" {
+		t.Errorf("Unexpected PR info: %+v", pr)
+	}
+	if pr != nil && pr.BaseSHA != "" {
+		t.Errorf("Expected no base SHA for issue_comment events, but got %s", pr.BaseSHA)
+	}
+
+	path = writeEvent(t, `{"action": "created", "issue": {"number": 8, "title": "Just an issue"}}`)
+	pr, err = ReadGitHubEvent("issue_comment", path)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if pr != nil {
+		t.Errorf("Expected nil PR info for plain issues, but got %+v", pr)
+	}
+}
+
+func TestReadGitHubEvent_Other(t *testing.T) {
+	path := writeEvent(t, `{"ref": "refs/heads/main"}`)
+	pr, err := ReadGitHubEvent("push", path)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if pr != nil {
+		t.Errorf("Expected nil PR info for push events, but got %+v", pr)
+	}
+
+	if _, err := ReadGitHubEvent("pull_request", filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing event file, but got nil")
+	}
+}
+
+func TestReadGitHubCommentEvent(t *testing.T) {
+	path := writeEvent(t, `{
+		"action": "created",
+		"issue": {"number": 7, "pull_request": {"url": "https://api.github.com/repos/o/r/pulls/7"}},
+		"comment": {"id": 11, "body": "/neuro explain", "user": {"login": "octocat"}}
+	}`)
+	c, err := ReadGitHubCommentEvent("issue_comment", path)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if c == nil || c.ID != 11 || c.Body != "/neuro explain" || c.Author != "octocat" || c.IsReviewComment() {
+		t.Errorf("Unexpected comment: %+v", c)
+	}
+
+	path = writeEvent(t, `{
+		"action": "created",
+		"pull_request": {"number": 7},
+		"comment": {"id": 12, "in_reply_to_id": 10, "body": "/neuro ask why?", "path": "main.go", "line": 4, "diff_hunk": "@@ -1 +1 @@", "user": {"login": "octocat"}}
+	}`)
+	c, err = ReadGitHubCommentEvent("pull_request_review_comment", path)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if c == nil || !c.IsReviewComment() || c.Path != "main.go" || c.Line != 4 || c.InReplyTo != 10 {
+		t.Errorf("Unexpected review comment: %+v", c)
+	}
+
+	path = writeEvent(t, `{"action": "edited", "issue": {"number": 7, "pull_request": {}}, "comment": {"id": 13}}`)
+	if c, err := ReadGitHubCommentEvent("issue_comment", path); err != nil || c != nil {
+		t.Errorf("Expected edited comments to be ignored, but got %+v, %v", c, err)
+	}
+	if c, err := ReadGitHubCommentEvent("pull_request", path); err != nil || c != nil {
+		t.Errorf("Expected non comment events to be ignored, but got %+v, %v", c, err)
+	}
+}
+
+func TestGitHub_FindComment(t *testing.T) {
+	const tag = "# NeuroSpecation AI Review\n"
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+		// Installation tokens, such as the Actions token, cannot read their user
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message": "Resource not accessible by integration"}`))
+	})
+	mux.HandleFunc("GET /api/v3/repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[
+			{"id": 1, "body": "# NeuroSpecation AI Review\nimposter", "user": {"login": "attacker"}},
+			{"id": 2, "body": "# NeuroSpecation AI Review\nreview", "user": {"login": "github-actions[bot]"}}
+		]`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := github.NewClient(nil).WithEnterpriseURLs(server.URL, server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	gh := &GitHub{Client: client, Owner: "owner", Repo: "repo"}
+	body, err := gh.FindComment(context.Background(), &PRInfo{Number: 1}, tag)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if body != tag+"review" {
+		t.Errorf("Expected the comment of the Actions bot, but got %q", body)
+	}
+
+	gh.Login = "neuro-review[bot]"
+	if body, err := gh.FindComment(context.Background(), &PRInfo{Number: 1}, tag); err != nil || body != "" {
+		t.Errorf("Expected no comment by the app, but got %q, err: %v", body, err)
+	}
+}
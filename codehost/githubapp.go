@@ -0,0 +1,152 @@
+package codehost
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/google/go-github/v69/github"
+	"strconv"
+	"time"
+)
+
+// GitHubAuth selects the GitHub API endpoint and the credentials used to call it.
+type GitHubAuth struct {
+	// BaseURL and UploadURL point at a GitHub Enterprise Server, leave empty for github.com
+	BaseURL   string
+	UploadURL string
+	// Token is a personal access token or Actions token, ignored when App is set
+	Token string
+	App   *GitHubApp
+}
+
+// GitHubApp holds the credentials of a GitHub App, which are exchanged for an installation token.
+type GitHubApp struct {
+	AppID int64
+	// InstallationID is looked up from the repository when 0
+	InstallationID int64
+	PrivateKey     []byte
+}
+
+// NewGitHubClient builds an API client for auth, returning it with the token it authenticates with and, for a GitHub
+// App, the login of the app's bot account that the token writes as.
+func NewGitHubClient(ctx context.Context, auth GitHubAuth, owner, repo string) (*github.Client, string, string, error) {
+	newClient := func(token string) (*github.Client, error) {
+		c := github.NewClient(nil).WithAuthToken(token)
+		if auth.BaseURL == "" {
+			return c, nil
+		}
+		uploadURL := auth.UploadURL
+		if uploadURL == "" {
+			uploadURL = auth.BaseURL
+		}
+		c, err := c.WithEnterpriseURLs(auth.BaseURL, uploadURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GitHub Enterprise URL %s: %w", auth.BaseURL, err)
+		}
+		return c, nil
+	}
+
+	token, login := auth.Token, ""
+	if auth.App != nil {
+		jwt, err := auth.App.JWT(time.Now())
+		if err != nil {
+			return nil, "", "", err
+		}
+		appClient, err := newClient(jwt)
+		if err != nil {
+			return nil, "", "", err
+		}
+		token, err = auth.App.installationToken(ctx, appClient, owner, repo)
+		if err != nil {
+			return nil, "", "", err
+		}
+		app, _, err := appClient.Apps.Get(ctx, "")
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to get the GitHub App: %w", err)
+		}
+		login = app.GetSlug() + "[bot]"
+	}
+
+	c, err := newClient(token)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return c, token, login, nil
+}
+
+func (app *GitHubApp) installationToken(ctx context.Context, appClient *github.Client, owner, repo string) (string, error) {
+	installationID := app.InstallationID
+	if installationID == 0 {
+		if owner == "" || repo == "" {
+			return "", fmt.Errorf("GitHub App installation ID is not set and the repository is unknown")
+		}
+		installation, _, err := appClient.Apps.FindRepositoryInstallation(ctx, owner, repo)
+		if err != nil {
+			return "", fmt.Errorf("failed to find GitHub App installation for %s/%s: %w", owner, repo, err)
+		}
+		installationID = installation.GetID()
+	}
+
+	token, _, err := appClient.Apps.CreateInstallationToken(ctx, installationID, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GitHub App installation token: %w", err)
+	}
+	return token.GetToken(), nil
+}
+
+// JWT returns the signed token that authenticates as the app itself.
+func (app *GitHubApp) JWT(now time.Time) (string, error) {
+	key, err := parseRSAPrivateKey(app.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	// Backdate to allow for clock drift, GitHub rejects tokens valid for more than 10 minutes
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(app.AppID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("GitHub App private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GitHub App private key must be an RSA key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,121 @@
+package codehost
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAppKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func TestGitHubApp_JWT(t *testing.T) {
+	key, pemKey := newTestAppKey(t)
+	app := &GitHubApp{AppID: 1234, PrivateKey: pemKey}
+
+	now := time.Unix(1700000000, 0)
+	jwt, err := app.JWT(now)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected 3 JWT parts, but got %d", len(parts))
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("Failed to decode claims: %v", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		t.Fatalf("Failed to parse claims: %v", err)
+	}
+	if claims["iss"] != "1234" || claims["iat"] != float64(now.Unix()-60) || claims["exp"] != float64(now.Unix()+540) {
+		t.Errorf("Unexpected claims: %v", claims)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("Failed to decode signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("Expected a valid signature, but got: %v", err)
+	}
+
+	if _, err := (&GitHubApp{AppID: 1, PrivateKey: []byte("not a key")}).JWT(now); err == nil {
+		t.Error("Expected an error for an invalid key, but got nil")
+	}
+}
+
+func TestNewGitHubClient_EnterpriseApp(t *testing.T) {
+	_, pemKey := newTestAppKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/owner/repo/installation", func(w http.ResponseWriter, r *http.Request) {
+		if strings.Count(r.Header.Get("Authorization"), ".") != 2 {
+			t.Errorf("Expected the installation lookup to use the app JWT, got %q", r.Header.Get("Authorization"))
+		}
+		_, _ = w.Write([]byte(`{"id": 99}`))
+	})
+	mux.HandleFunc("POST /api/v3/app/installations/99/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"token": "ghs_installation"}`))
+	})
+	mux.HandleFunc("GET /api/v3/app", func(w http.ResponseWriter, r *http.Request) {
+		if strings.Count(r.Header.Get("Authorization"), ".") != 2 {
+			t.Errorf("Expected the app lookup to use the app JWT, got %q", r.Header.Get("Authorization"))
+		}
+		_, _ = w.Write([]byte(`{"id": 1234, "slug": "neuro-review"}`))
+	})
+	mux.HandleFunc("GET /api/v3/repos/owner/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ghs_installation" {
+			t.Errorf("Expected the installation token to be used, got %q", r.Header.Get("Authorization"))
+		}
+		_, _ = w.Write([]byte(`{"number": 1, "title": "Enterprise PR"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	auth := GitHubAuth{
+		BaseURL: server.URL,
+		App:     &GitHubApp{AppID: 1234, PrivateKey: pemKey},
+	}
+	client, token, login, err := NewGitHubClient(context.Background(), auth, "owner", "repo")
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if token != "ghs_installation" {
+		t.Errorf("Expected the installation token, but got %q", token)
+	}
+	if login != "neuro-review[bot]" {
+		t.Errorf("Expected the app's bot account, but got %q", login)
+	}
+
+	gh := &GitHub{Client: client, Owner: "owner", Repo: "repo", Token: token, PRNumber: 1}
+	pr, err := gh.GetPRInfo(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if pr.Title != "Enterprise PR" {
+		t.Errorf("Expected PR from the enterprise server, but got %+v", pr)
+	}
+}
@@ -0,0 +1,86 @@
+package codehost
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v69/github"
+)
+
+// GitHub accepts at most 50 annotations per check run request, and at most 65535 characters of summary.
+const (
+	maxAnnotationsPerRequest = 50
+	maxCheckSummary          = 65535
+)
+
+func (gh *GitHub) PublishCheck(ctx context.Context, pr *PRInfo, check Check) (string, error) {
+	if err := gh.checkRepo(); err != nil {
+		return "", err
+	}
+	if pr.HeadSHA == "" {
+		return "", fmt.Errorf("head SHA is required to publish a check run")
+	}
+
+	summary := truncateSummary(check.Summary)
+
+	var annotations []*github.CheckRunAnnotation
+	for _, a := range check.Annotations {
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			Path:            github.Ptr(a.Path),
+			StartLine:       github.Ptr(a.StartLine),
+			EndLine:         github.Ptr(a.EndLine),
+			AnnotationLevel: github.Ptr(a.Level),
+			Title:           github.Ptr(a.Title),
+			Message:         github.Ptr(a.Message),
+		})
+	}
+	output := func(batch []*github.CheckRunAnnotation) *github.CheckRunOutput {
+		return &github.CheckRunOutput{
+			Title:       github.Ptr(check.Title),
+			Summary:     github.Ptr(summary),
+			Annotations: batch,
+		}
+	}
+	batch := annotations[:min(len(annotations), maxAnnotationsPerRequest)]
+
+	now := github.Timestamp{Time: time.Now()}
+	run, _, err := gh.Client.Checks.CreateCheckRun(ctx, gh.Owner, gh.Repo, github.CreateCheckRunOptions{
+		Name:        check.Name,
+		HeadSHA:     pr.HeadSHA,
+		Status:      github.Ptr("completed"),
+		Conclusion:  github.Ptr(check.Conclusion),
+		CompletedAt: &now,
+		Output:      output(batch),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create check run, err: %w", err)
+	}
+
+	// Further annotations are appended by updating the check run
+	for i := len(batch); i < len(annotations); i += maxAnnotationsPerRequest {
+		batch = annotations[i:min(len(annotations), i+maxAnnotationsPerRequest)]
+		_, _, err := gh.Client.Checks.UpdateCheckRun(ctx, gh.Owner, gh.Repo, run.GetID(), github.UpdateCheckRunOptions{
+			Name:   check.Name,
+			Output: output(batch),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to add annotations to check run, err: %w", err)
+		}
+	}
+	return run.GetHTMLURL(), nil
+}
+
+// truncateSummary shortens summary to maxCheckSummary bytes, which keeps it within as many characters, cutting on a
+// character boundary so the summary stays valid UTF-8.
+func truncateSummary(summary string) string {
+	if len(summary) <= maxCheckSummary {
+		return summary
+	}
+	end := maxCheckSummary - len("\n…")
+	for end > 0 && !utf8.RuneStart(summary[end]) {
+		end--
+	}
+	return summary[:end] + "\n…"
+}
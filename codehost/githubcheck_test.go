@@ -0,0 +1,85 @@
+package codehost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v69/github"
+)
+
+func TestGitHub_PublishCheck(t *testing.T) {
+	var created github.CreateCheckRunOptions
+	var updates []github.UpdateCheckRunOptions
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v3/repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"id": 7, "html_url": "https://github.example.com/owner/repo/runs/7"}`))
+	})
+	mux.HandleFunc("PATCH /api/v3/repos/owner/repo/check-runs/7", func(w http.ResponseWriter, r *http.Request) {
+		var update github.UpdateCheckRunOptions
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		updates = append(updates, update)
+		_, _ = w.Write([]byte(`{"id": 7}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := github.NewClient(nil).WithEnterpriseURLs(server.URL, server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	gh := &GitHub{Client: client, Owner: "owner", Repo: "repo"}
+
+	check := Check{Name: "NeuroSpecation", Title: "2 findings", Summary: "summary", Conclusion: "failure"}
+	for i := 0; i < 120; i++ {
+		check.Annotations = append(check.Annotations, Annotation{
+			Path: "main.go", StartLine: i + 1, EndLine: i + 1, Level: AnnotationWarning, Title: "t", Message: fmt.Sprintf("m%d", i),
+		})
+	}
+
+	url, err := gh.PublishCheck(context.Background(), &PRInfo{Number: 1, HeadSHA: "head456"}, check)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if url != "https://github.example.com/owner/repo/runs/7" {
+		t.Errorf("Unexpected check run URL %q", url)
+	}
+	if created.Name != "NeuroSpecation" || created.HeadSHA != "head456" || created.GetConclusion() != "failure" || created.GetStatus() != "completed" {
+		t.Errorf("Unexpected check run: %+v", created)
+	}
+	if len(created.Output.Annotations) != 50 {
+		t.Errorf("Expected the first 50 annotations on creation, but got %d", len(created.Output.Annotations))
+	}
+	if len(updates) != 2 || len(updates[0].Output.Annotations) != 50 || len(updates[1].Output.Annotations) != 20 {
+		t.Errorf("Expected the remaining annotations in batches of 50, but got %d updates", len(updates))
+	}
+
+	if _, err := gh.PublishCheck(context.Background(), &PRInfo{Number: 1}, check); err == nil {
+		t.Error("Expected an error without a head SHA, but got nil")
+	}
+}
+
+func TestTruncateSummary(t *testing.T) {
+	if got := truncateSummary("short"); got != "short" {
+		t.Errorf("Expected a short summary to be unchanged, but got %q", got)
+	}
+	// Three-byte characters do not line up with the cut, which would otherwise split one
+	summary := truncateSummary(strings.Repeat("€", maxCheckSummary))
+	if len(summary) > maxCheckSummary || !utf8.ValidString(summary) {
+		t.Errorf("Expected at most %d bytes of valid UTF-8, but got %d bytes, valid %v", maxCheckSummary, len(summary), utf8.ValidString(summary))
+	}
+	if !strings.HasSuffix(summary, "€\n…") {
+		t.Errorf("Expected the summary to end with the ellipsis after a whole character, but got %q", summary[len(summary)-8:])
+	}
+}
@@ -0,0 +1,145 @@
+package codehost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/go-github/v69/github"
+	"os"
+)
+
+// maxThreadComments bounds how much of a long conversation is returned as thread history.
+const maxThreadComments = 30
+
+func (gh *GitHub) TriggerComment(ctx context.Context) (*Comment, error) {
+	if gh.EventPath == "" {
+		return nil, nil
+	}
+	return ReadGitHubCommentEvent(gh.EventName, gh.EventPath)
+}
+
+// ReadGitHubCommentEvent returns the newly created comment of an issue_comment or pull_request_review_comment event.
+func ReadGitHubCommentEvent(eventName, eventPath string) (*Comment, error) {
+	switch eventName {
+	case "issue_comment", "pull_request_review_comment":
+	default:
+		return nil, nil
+	}
+
+	payload, err := os.ReadFile(eventPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GITHUB_EVENT_PATH %s: %w", eventPath, err)
+	}
+
+	if eventName == "issue_comment" {
+		var event github.IssueCommentEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, fmt.Errorf("failed to parse %s event: %w", eventName, err)
+		}
+		if event.GetAction() != "created" || event.Comment == nil || !event.GetIssue().IsPullRequest() {
+			return nil, nil
+		}
+		return &Comment{
+			ID:                event.Comment.GetID(),
+			Author:            event.Comment.GetUser().GetLogin(),
+			AuthorAssociation: event.Comment.GetAuthorAssociation(),
+			Body:              event.Comment.GetBody(),
+		}, nil
+	}
+
+	var event github.PullRequestReviewCommentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse %s event: %w", eventName, err)
+	}
+	if event.GetAction() != "created" || event.Comment == nil {
+		return nil, nil
+	}
+	return reviewComment(event.Comment), nil
+}
+
+func reviewComment(c *github.PullRequestComment) *Comment {
+	return &Comment{
+		ID:                c.GetID(),
+		Author:            c.GetUser().GetLogin(),
+		AuthorAssociation: c.GetAuthorAssociation(),
+		Body:              c.GetBody(),
+		Path:              c.GetPath(),
+		Line:              c.GetLine(),
+		DiffHunk:          c.GetDiffHunk(),
+		InReplyTo:         c.GetInReplyTo(),
+	}
+}
+
+func (gh *GitHub) Thread(ctx context.Context, pr *PRInfo, c *Comment) ([]Comment, error) {
+	if err := gh.checkRepo(); err != nil {
+		return nil, err
+	}
+
+	var thread []Comment
+	if !c.IsReviewComment() {
+		opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			comments, resp, err := gh.Client.Issues.ListComments(ctx, gh.Owner, gh.Repo, pr.Number, opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list comments on PR, err: %w", err)
+			}
+			for _, ic := range comments {
+				thread = append(thread, Comment{ID: ic.GetID(), Author: ic.GetUser().GetLogin(), Body: ic.GetBody()})
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+	} else {
+		root := c.InReplyTo
+		if root == 0 {
+			root = c.ID
+		}
+		opts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			comments, resp, err := gh.Client.PullRequests.ListComments(ctx, gh.Owner, gh.Repo, pr.Number, opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list review comments on PR, err: %w", err)
+			}
+			for _, rc := range comments {
+				if rc.GetID() == root || rc.GetInReplyTo() == root {
+					thread = append(thread, *reviewComment(rc))
+				}
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+	}
+
+	if len(thread) > maxThreadComments {
+		thread = thread[len(thread)-maxThreadComments:]
+	}
+	return thread, nil
+}
+
+func (gh *GitHub) Reply(ctx context.Context, pr *PRInfo, c *Comment, body string) (string, error) {
+	if err := gh.checkRepo(); err != nil {
+		return "", err
+	}
+
+	if !c.IsReviewComment() {
+		reply, _, err := gh.Client.Issues.CreateComment(ctx, gh.Owner, gh.Repo, pr.Number, &github.IssueComment{Body: &body})
+		if err != nil {
+			return "", fmt.Errorf("failed to reply on PR, err: %w", err)
+		}
+		return reply.GetHTMLURL(), nil
+	}
+
+	root := c.InReplyTo
+	if root == 0 {
+		root = c.ID
+	}
+	reply, _, err := gh.Client.PullRequests.CreateCommentInReplyTo(ctx, gh.Owner, gh.Repo, pr.Number, body, root)
+	if err != nil {
+		return "", fmt.Errorf("failed to reply in review thread, err: %w", err)
+	}
+	return reply.GetHTMLURL(), nil
+}
@@ -0,0 +1,65 @@
+package codehost
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/v69/github"
+	"strings"
+)
+
+func (gh *GitHub) RepoLabels(ctx context.Context) ([]string, error) {
+	if err := gh.checkRepo(); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		labels, resp, err := gh.Client.Issues.ListLabels(ctx, gh.Owner, gh.Repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list repository labels, err: %w", err)
+		}
+		for _, l := range labels {
+			names = append(names, l.GetName())
+		}
+		if resp.NextPage == 0 {
+			return names, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (gh *GitHub) AddLabels(ctx context.Context, pr *PRInfo, labels []string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+	if err := gh.checkRepo(); err != nil {
+		return err
+	}
+	if _, _, err := gh.Client.Issues.AddLabelsToIssue(ctx, gh.Owner, gh.Repo, pr.Number, labels); err != nil {
+		return fmt.Errorf("failed to add labels to PR, err: %w", err)
+	}
+	return nil
+}
+
+func (gh *GitHub) RequestReviewers(ctx context.Context, pr *PRInfo, reviewers []string) error {
+	if len(reviewers) == 0 {
+		return nil
+	}
+	if err := gh.checkRepo(); err != nil {
+		return err
+	}
+
+	var req github.ReviewersRequest
+	for _, r := range reviewers {
+		if _, team, ok := strings.Cut(r, "/"); ok {
+			req.TeamReviewers = append(req.TeamReviewers, team)
+		} else {
+			req.Reviewers = append(req.Reviewers, r)
+		}
+	}
+	if _, _, err := gh.Client.PullRequests.RequestReviewers(ctx, gh.Owner, gh.Repo, pr.Number, req); err != nil {
+		return fmt.Errorf("failed to request reviewers, err: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package codehost
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v69/github"
+)
+
+func TestGitHub_Triage(t *testing.T) {
+	var added []string
+	var requested github.ReviewersRequest
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/owner/repo/labels", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			_, _ = w.Write([]byte(`[{"name": "security"}]`))
+			return
+		}
+		w.Header().Set("Link", `<`+r.URL.Path+`?page=2>; rel="next"`)
+		_, _ = w.Write([]byte(`[{"name": "bug"}, {"name": "enhancement"}]`))
+	})
+	mux.HandleFunc("POST /api/v3/repos/owner/repo/issues/3/labels", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&added); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("POST /api/v3/repos/owner/repo/pulls/3/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&requested); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"number": 3}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := github.NewClient(nil).WithEnterpriseURLs(server.URL, server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	gh := &GitHub{Client: client, Owner: "owner", Repo: "repo"}
+	pr := &PRInfo{Number: 3}
+
+	labels, err := gh.RepoLabels(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if want := []string{"bug", "enhancement", "security"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("Expected labels %v from both pages, but got %v", want, labels)
+	}
+
+	if err := gh.AddLabels(context.Background(), pr, []string{"bug"}); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(added, []string{"bug"}) {
+		t.Errorf("Expected the bug label to be added, but got %v", added)
+	}
+
+	if err := gh.RequestReviewers(context.Background(), pr, []string{"alice", "org/platform"}); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(requested.Reviewers, []string{"alice"}) || !reflect.DeepEqual(requested.TeamReviewers, []string{"platform"}) {
+		t.Errorf("Expected a user and a team reviewer, but got %+v", requested)
+	}
+}
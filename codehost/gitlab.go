@@ -0,0 +1,308 @@
+package codehost
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GitLab posts reviews to GitLab merge requests.
+type GitLab struct {
+	// BaseURL is the v4 API root, e.g. https://gitlab.example.com/api/v4
+	BaseURL    string
+	Token      string
+	ProjectID  string
+	MRIID      int
+	HTTPClient *http.Client
+
+	// envPR is the merge request as described by the CI predefined variables, used when there is no token
+	envPR *PRInfo
+	mr    *gitlabMR
+	rest  *restClient
+	// login is the username of the token, see self
+	login string
+}
+
+type gitlabMR struct {
+	IID          int      `json:"iid"`
+	Title        string   `json:"title"`
+	Description  string   `json:"description"`
+	Draft        bool     `json:"draft"`
+	Labels       []string `json:"labels"`
+	TargetBranch string   `json:"target_branch"`
+	SHA          string   `json:"sha"`
+	Author       struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	DiffRefs struct {
+		BaseSHA  string `json:"base_sha"`
+		HeadSHA  string `json:"head_sha"`
+		StartSHA string `json:"start_sha"`
+	} `json:"diff_refs"`
+}
+
+type gitlabNote struct {
+	ID     int64  `json:"id"`
+	Body   string `json:"body"`
+	Author struct {
+		Username string `json:"username"`
+	} `json:"author"`
+}
+
+type gitlabDiff struct {
+	OldPath string `json:"old_path"`
+	NewPath string `json:"new_path"`
+}
+
+// NewGitLabFromEnv configures a GitLab host from the GitLab CI predefined variables.
+// GITLAB_TOKEN must hold a token with api scope to write to the merge request.
+func NewGitLabFromEnv() (*GitLab, error) {
+	gl := &GitLab{
+		BaseURL:   os.Getenv("CI_API_V4_URL"),
+		Token:     os.Getenv("GITLAB_TOKEN"),
+		ProjectID: os.Getenv("CI_PROJECT_ID"),
+	}
+
+	iid := os.Getenv("CI_MERGE_REQUEST_IID")
+	if iid == "" {
+		return gl, nil
+	}
+	mrIID, err := strconv.Atoi(iid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CI_MERGE_REQUEST_IID format, got %s: err: %w", iid, err)
+	}
+	gl.MRIID = mrIID
+
+	var labels []string
+	if l := os.Getenv("CI_MERGE_REQUEST_LABELS"); l != "" {
+		labels = strings.Split(l, ",")
+	}
+	gl.envPR = &PRInfo{
+		Number:  mrIID,
+		Title:   os.Getenv("CI_MERGE_REQUEST_TITLE"),
+		Body:    os.Getenv("CI_MERGE_REQUEST_DESCRIPTION"),
+		BaseRef: os.Getenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME"),
+		BaseSHA: os.Getenv("CI_MERGE_REQUEST_DIFF_BASE_SHA"),
+		HeadSHA: os.Getenv("CI_COMMIT_SHA"),
+		Draft:   os.Getenv("CI_MERGE_REQUEST_DRAFT") == "true",
+		Labels:  labels,
+		Author:  os.Getenv("GITLAB_USER_LOGIN"),
+	}
+	return gl, nil
+}
+
+func (gl *GitLab) client() *restClient {
+	if gl.rest == nil {
+		gl.rest = newRestClient(gl.BaseURL, gl.HTTPClient, func(req *http.Request) {
+			req.Header.Set("PRIVATE-TOKEN", gl.Token)
+		})
+	}
+	return gl.rest
+}
+
+func (gl *GitLab) mrPath(pr *PRInfo) string {
+	return fmt.Sprintf("/projects/%s/merge_requests/%d", url.PathEscape(gl.ProjectID), pr.Number)
+}
+
+func (gl *GitLab) checkProject() error {
+	if gl.BaseURL == "" {
+		return fmt.Errorf("CI_API_V4_URL environment variable is not set")
+	}
+	if gl.ProjectID == "" {
+		return fmt.Errorf("CI_PROJECT_ID environment variable is not set")
+	}
+	return nil
+}
+
+func (gl *GitLab) GetPRInfo(ctx context.Context) (*PRInfo, error) {
+	if gl.MRIID == 0 {
+		slog.Debug("not running in a merge request pipeline (CI_MERGE_REQUEST_IID)")
+		return nil, nil
+	}
+	if gl.Token == "" {
+		return gl.envPR, nil
+	}
+
+	mr, err := gl.getMR(ctx, &PRInfo{Number: gl.MRIID})
+	if err != nil {
+		return nil, err
+	}
+	return &PRInfo{
+		Number:  mr.IID,
+		Title:   mr.Title,
+		Body:    mr.Description,
+		BaseRef: mr.TargetBranch,
+		BaseSHA: mr.DiffRefs.BaseSHA,
+		HeadSHA: mr.DiffRefs.HeadSHA,
+		Draft:   mr.Draft,
+		Labels:  mr.Labels,
+		Author:  mr.Author.Username,
+	}, nil
+}
+
+func (gl *GitLab) getMR(ctx context.Context, pr *PRInfo) (*gitlabMR, error) {
+	if gl.mr != nil && gl.mr.IID == pr.Number {
+		return gl.mr, nil
+	}
+	if err := gl.checkProject(); err != nil {
+		return nil, err
+	}
+	var mr gitlabMR
+	if _, err := gl.client().do(ctx, http.MethodGet, gl.mrPath(pr), nil, &mr); err != nil {
+		return nil, fmt.Errorf("unable to get merge request. err: %w", err)
+	}
+	gl.mr = &mr
+	return gl.mr, nil
+}
+
+func (gl *GitLab) FindComment(ctx context.Context, pr *PRInfo, tag string) (string, error) {
+	existing, err := gl.findNote(ctx, pr, tag)
+	if err != nil || existing == nil {
+		return "", err
+	}
+	return existing.Body, nil
+}
+
+func (gl *GitLab) findNote(ctx context.Context, pr *PRInfo, tag string) (*gitlabNote, error) {
+	if err := gl.checkProject(); err != nil {
+		return nil, err
+	}
+
+	login, err := gl.self(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for page := "1"; page != ""; {
+		var notes []gitlabNote
+		resp, err := gl.client().do(ctx, http.MethodGet, gl.mrPath(pr)+"/notes?per_page=100&page="+page, nil, &notes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list notes on merge request, err: %w", err)
+		}
+		for i := range notes {
+			if notes[i].Author.Username == login && strings.Contains(notes[i].Body, tag) {
+				return &notes[i], nil
+			}
+		}
+		page = resp.Header.Get("X-Next-Page")
+	}
+	return nil, nil
+}
+
+// self returns the username of the token, which the notes are written as.
+func (gl *GitLab) self(ctx context.Context) (string, error) {
+	if gl.login == "" {
+		var user struct {
+			Username string `json:"username"`
+		}
+		if _, err := gl.client().do(ctx, http.MethodGet, "/user", nil, &user); err != nil {
+			return "", fmt.Errorf("failed to look up the user of the GitLab token: %w", err)
+		}
+		gl.login = user.Username
+	}
+	return gl.login, nil
+}
+
+func (gl *GitLab) UpsertComment(ctx context.Context, pr *PRInfo, tag, body string) (string, error) {
+	existing, err := gl.findNote(ctx, pr, tag)
+	if err != nil {
+		return "", err
+	}
+
+	req := map[string]string{"body": body}
+	var note gitlabNote
+	if existing != nil {
+		path := fmt.Sprintf("%s/notes/%d", gl.mrPath(pr), existing.ID)
+		if _, err := gl.client().do(ctx, http.MethodPut, path, req, &note); err != nil {
+			return "", fmt.Errorf("failed to update note on merge request, err: %w", err)
+		}
+	} else {
+		if _, err := gl.client().do(ctx, http.MethodPost, gl.mrPath(pr)+"/notes", req, &note); err != nil {
+			return "", fmt.Errorf("failed to create note on merge request, err: %w", err)
+		}
+	}
+	return gl.noteURL(pr, note.ID), nil
+}
+
+func (gl *GitLab) noteURL(pr *PRInfo, noteID int64) string {
+	projectURL := os.Getenv("CI_MERGE_REQUEST_PROJECT_URL")
+	if projectURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/-/merge_requests/%d#note_%d", projectURL, pr.Number, noteID)
+}
+
+func (gl *GitLab) PostInlineComments(ctx context.Context, pr *PRInfo, comments []InlineComment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	mr, err := gl.getMR(ctx, pr)
+	if err != nil {
+		return err
+	}
+	oldPaths, err := gl.oldPaths(ctx, pr)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range comments {
+		oldPath, ok := oldPaths[c.Path]
+		if !ok {
+			oldPath = c.Path
+		}
+		body := c.Body
+		if c.StartLine > 0 && c.StartLine < c.Line {
+			// GitLab suggestions replace the anchor line, multi-line ones say how many lines above it they cover
+			body = strings.ReplaceAll(body, "```suggestion\n", fmt.Sprintf("```suggestion:-%d+0\n", c.Line-c.StartLine))
+		}
+		req := map[string]any{
+			"body": body,
+			"position": map[string]any{
+				"position_type": "text",
+				"base_sha":      mr.DiffRefs.BaseSHA,
+				"start_sha":     mr.DiffRefs.StartSHA,
+				"head_sha":      mr.DiffRefs.HeadSHA,
+				"old_path":      oldPath,
+				"new_path":      c.Path,
+				"new_line":      c.Line,
+			},
+		}
+		if _, err := gl.client().do(ctx, http.MethodPost, gl.mrPath(pr)+"/discussions", req, nil); err != nil {
+			return fmt.Errorf("failed to create discussion on %s:%d, err: %w", c.Path, c.Line, err)
+		}
+	}
+	return nil
+}
+
+// oldPaths maps the new path of every file in the merge request diff to its path before the change, which differ
+// for renamed files. GitLab rejects positions on a renamed file unless they name both.
+func (gl *GitLab) oldPaths(ctx context.Context, pr *PRInfo) (map[string]string, error) {
+	paths := map[string]string{}
+	for page := "1"; page != ""; {
+		var diffs []gitlabDiff
+		resp, err := gl.client().do(ctx, http.MethodGet, gl.mrPath(pr)+"/diffs?per_page=100&page="+page, nil, &diffs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list merge request diffs, err: %w", err)
+		}
+		for _, d := range diffs {
+			paths[d.NewPath] = d.OldPath
+		}
+		page = resp.Header.Get("X-Next-Page")
+	}
+	return paths, nil
+}
+
+func (gl *GitLab) UpdateDescription(ctx context.Context, pr *PRInfo, body string) error {
+	if err := gl.checkProject(); err != nil {
+		return err
+	}
+	if _, err := gl.client().do(ctx, http.MethodPut, gl.mrPath(pr), map[string]string{"description": body}, nil); err != nil {
+		return fmt.Errorf("failed to update merge request description, err: %w", err)
+	}
+	return nil
+}
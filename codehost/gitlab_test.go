@@ -0,0 +1,293 @@
+package codehost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGitLab is an in-memory stand-in for the parts of the GitLab REST API used by the GitLab host.
+type fakeGitLab struct {
+	mu          sync.Mutex
+	t           *testing.T
+	notes       []gitlabNote
+	discussions []map[string]any
+	description string
+	nextNoteID  int64
+}
+
+func newFakeGitLab(t *testing.T) (*fakeGitLab, *httptest.Server) {
+	f := &fakeGitLab{t: t, description: "original", nextNoteID: 100}
+	const mrPath = "/api/v4/projects/group%2Fproject/merge_requests/5"
+	routes := map[string]http.HandlerFunc{}
+
+	routes[mrPath] = func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			f.writeJSON(w, map[string]any{
+				"iid":           5,
+				"title":         "Add GitLab",
+				"description":   f.description,
+				"draft":         true,
+				"labels":        []string{"backend"},
+				"author":        map[string]string{"username": "gitlab-user"},
+				"target_branch": "main",
+				"diff_refs": map[string]string{
+					"base_sha":  "base123",
+					"head_sha":  "head456",
+					"start_sha": "start789",
+				},
+			})
+		case http.MethodPut:
+			var req map[string]string
+			f.readJSON(r, &req)
+			f.description = req["description"]
+			f.writeJSON(w, map[string]any{"iid": 5})
+		}
+	}
+	routes[mrPath+"/notes"] = func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			// Serve one note per page to exercise pagination
+			page := r.URL.Query().Get("page")
+			idx := 0
+			fmt.Sscanf(page, "%d", &idx)
+			idx--
+			if idx+1 < len(f.notes) {
+				w.Header().Set("X-Next-Page", fmt.Sprintf("%d", idx+2))
+			}
+			if idx < 0 || idx >= len(f.notes) {
+				f.writeJSON(w, []gitlabNote{})
+				return
+			}
+			f.writeJSON(w, []gitlabNote{f.notes[idx]})
+		case http.MethodPost:
+			var req map[string]string
+			f.readJSON(r, &req)
+			f.nextNoteID++
+			note := newGitLabNote(f.nextNoteID, "neuro-bot", req["body"])
+			f.notes = append(f.notes, note)
+			f.writeJSON(w, note)
+		}
+	}
+	routes["/api/v4/user"] = func(w http.ResponseWriter, r *http.Request) {
+		f.writeJSON(w, map[string]any{"username": "neuro-bot"})
+	}
+	noteHandler := func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var req map[string]string
+		f.readJSON(r, &req)
+		id := strings.TrimPrefix(r.URL.EscapedPath(), mrPath+"/notes/")
+		for i := range f.notes {
+			if fmt.Sprintf("%d", f.notes[i].ID) == id {
+				f.notes[i].Body = req["body"]
+				f.writeJSON(w, f.notes[i])
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}
+	routes[mrPath+"/diffs"] = func(w http.ResponseWriter, r *http.Request) {
+		// Serve one file per page to exercise pagination
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("X-Next-Page", "2")
+			f.writeJSON(w, []gitlabDiff{{OldPath: "cmd/pr.go", NewPath: "cmd/pr.go"}})
+			return
+		}
+		f.writeJSON(w, []gitlabDiff{{OldPath: "cmd/old_name.go", NewPath: "cmd/new_name.go"}})
+	}
+	routes[mrPath+"/discussions"] = func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var req map[string]any
+		f.readJSON(r, &req)
+		f.discussions = append(f.discussions, req)
+		f.writeJSON(w, map[string]any{"id": "abc"})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "test_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// Route on the escaped path as the project ID contains an encoded slash
+		path := r.URL.EscapedPath()
+		if h, ok := routes[path]; ok {
+			h(w, r)
+			return
+		}
+		if strings.HasPrefix(path, mrPath+"/notes/") {
+			noteHandler(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	return f, server
+}
+
+func (f *fakeGitLab) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		f.t.Errorf("Failed to write response: %v", err)
+	}
+}
+
+func (f *fakeGitLab) readJSON(r *http.Request, v any) {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		f.t.Errorf("Failed to decode request: %v", err)
+	}
+}
+
+func newGitLabNote(id int64, author, body string) gitlabNote {
+	n := gitlabNote{ID: id, Body: body}
+	n.Author.Username = author
+	return n
+}
+
+func newTestGitLab(url string) *GitLab {
+	return &GitLab{
+		BaseURL:   url + "/api/v4",
+		Token:     "test_token",
+		ProjectID: "group/project",
+		MRIID:     5,
+	}
+}
+
+func TestGitLab_GetPRInfo(t *testing.T) {
+	_, server := newFakeGitLab(t)
+	defer server.Close()
+
+	pr, err := newTestGitLab(server.URL).GetPRInfo(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if pr.Number != 5 || pr.Title != "Add GitLab" || pr.Body != "original" || !pr.Draft {
+		t.Errorf("Unexpected MR info: %+v", pr)
+	}
+	if pr.BaseSHA != "base123" || pr.HeadSHA != "head456" || pr.BaseRef != "main" {
+		t.Errorf("Unexpected MR refs: %+v", pr)
+	}
+	if pr.Author != "gitlab-user" {
+		t.Errorf("Expected author gitlab-user, but got %q", pr.Author)
+	}
+
+	gl := newTestGitLab(server.URL)
+	gl.MRIID = 0
+	pr, err = gl.GetPRInfo(context.Background())
+	if err != nil || pr != nil {
+		t.Errorf("Expected nil MR info outside a merge request pipeline, but got %+v, %v", pr, err)
+	}
+}
+
+func TestGitLab_GetPRInfoFromEnv(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", "")
+	t.Setenv("CI_MERGE_REQUEST_IID", "7")
+	t.Setenv("CI_MERGE_REQUEST_TITLE", "Add GitLab")
+	t.Setenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME", "main")
+	t.Setenv("GITLAB_USER_LOGIN", "gitlab-user")
+
+	gl, err := NewGitLabFromEnv()
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	pr, err := gl.GetPRInfo(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if pr.Number != 7 || pr.Title != "Add GitLab" || pr.BaseRef != "main" {
+		t.Errorf("Unexpected MR info: %+v", pr)
+	}
+	if pr.Author != "gitlab-user" {
+		t.Errorf("Expected author gitlab-user, but got %q", pr.Author)
+	}
+}
+
+func TestGitLab_UpsertComment(t *testing.T) {
+	fake, server := newFakeGitLab(t)
+	defer server.Close()
+	const tag = "# NeuroSpecation AI Review\n"
+	// Anyone can write a note with the tag, only the token user's notes count
+	fake.notes = []gitlabNote{newGitLabNote(1, "dev", "unrelated"), newGitLabNote(2, "dev", tag+"imposter")}
+
+	gl := newTestGitLab(server.URL)
+	pr := &PRInfo{Number: 5}
+
+	if body, err := gl.FindComment(context.Background(), pr, tag); err != nil || body != "" {
+		t.Fatalf("Expected no tagged note, but got %q, err: %v", body, err)
+	}
+
+	if _, err := gl.UpsertComment(context.Background(), pr, tag, tag+"first"); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if len(fake.notes) != 3 || fake.notes[2].Body != tag+"first" {
+		t.Fatalf("Expected a new note to be created, but got %+v", fake.notes)
+	}
+
+	if _, err := gl.UpsertComment(context.Background(), pr, tag, tag+"second"); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if len(fake.notes) != 3 || fake.notes[2].Body != tag+"second" {
+		t.Errorf("Expected the tagged note to be updated, but got %+v", fake.notes)
+	}
+
+	if body, err := gl.FindComment(context.Background(), pr, tag); err != nil || body != tag+"second" {
+		t.Errorf("Expected the tagged note to be found, but got %q, err: %v", body, err)
+	}
+}
+
+func TestGitLab_PostInlineComments(t *testing.T) {
+	fake, server := newFakeGitLab(t)
+	defer server.Close()
+
+	gl := newTestGitLab(server.URL)
+	err := gl.PostInlineComments(context.Background(), &PRInfo{Number: 5}, []InlineComment{
+		{Path: "cmd/pr.go", Line: 12, Body: "Consider handling this error"},
+		{Path: "cmd/new_name.go", Line: 3, Body: "Renamed file"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if len(fake.discussions) != 2 {
+		t.Fatalf("Expected 2 discussions, but got %d", len(fake.discussions))
+	}
+	pos := fake.discussions[0]["position"].(map[string]any)
+	if pos["old_path"] != "cmd/pr.go" || pos["new_path"] != "cmd/pr.go" || pos["new_line"] != float64(12) {
+		t.Errorf("Unexpected position: %v", pos)
+	}
+	if pos["base_sha"] != "base123" || pos["start_sha"] != "start789" || pos["head_sha"] != "head456" {
+		t.Errorf("Expected position to use the MR diff refs, but got %v", pos)
+	}
+	pos = fake.discussions[1]["position"].(map[string]any)
+	if pos["old_path"] != "cmd/old_name.go" || pos["new_path"] != "cmd/new_name.go" {
+		t.Errorf("Expected the renamed file's position to name its old path, but got %v", pos)
+	}
+}
+
+func TestGitLab_UpdateDescription(t *testing.T) {
+	fake, server := newFakeGitLab(t)
+	defer server.Close()
+
+	err := newTestGitLab(server.URL).UpdateDescription(context.Background(), &PRInfo{Number: 5}, "new description")
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if fake.description != "new description" {
+		t.Errorf("Expected description to be updated, but got %q", fake.description)
+	}
+
+	gl := newTestGitLab(server.URL)
+	gl.Token = "wrong"
+	if err := gl.UpdateDescription(context.Background(), &PRInfo{Number: 5}, "x"); err == nil {
+		t.Error("Expected an error for an unauthorized request, but got nil")
+	}
+}
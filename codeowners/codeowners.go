@@ -0,0 +1,102 @@
+// Package codeowners reads CODEOWNERS files to find who owns the files a pull request changes.
+package codeowners
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Paths are the locations GitHub and GitLab read the CODEOWNERS file from, in order of preference.
+var Paths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
+
+// Rule assigns owners to the paths matching a pattern.
+type Rule struct {
+	Pattern string
+	Owners  []string
+	re      *regexp.Regexp
+}
+
+// Rules are the rules of a CODEOWNERS file, in file order. The last matching rule wins.
+type Rules []Rule
+
+// Load reads the first CODEOWNERS file found in the repository, returning nil if there is none.
+func Load(gitRoot string) (Rules, error) {
+	for _, p := range Paths {
+		content, err := os.ReadFile(filepath.Join(gitRoot, p))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return Parse(string(content)), nil
+	}
+	return nil, nil
+}
+
+// Parse reads CODEOWNERS content, skipping comments, blank lines and GitLab section headers.
+func Parse(content string) Rules {
+	var rules Rules
+	for _, line := range strings.Split(content, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "[") || strings.HasPrefix(fields[0], "^[") {
+			continue
+		}
+		rules = append(rules, Rule{
+			Pattern: fields[0],
+			Owners:  fields[1:],
+			re:      patternRegexp(fields[0]),
+		})
+	}
+	return rules
+}
+
+// Owners returns the owners of path, relative to the repository root, or nil if no rule matches.
+func (r Rules) Owners(path string) []string {
+	path = strings.TrimPrefix(filepath.ToSlash(path), "/")
+	for i := len(r) - 1; i >= 0; i-- {
+		if r[i].re.MatchString(path) {
+			return r[i].Owners
+		}
+	}
+	return nil
+}
+
+// Match reports whether path, relative to the repository root, matches a gitignore style pattern as CODEOWNERS rules do.
+func Match(pattern, path string) bool {
+	return patternRegexp(pattern).MatchString(strings.TrimPrefix(filepath.ToSlash(path), "/"))
+}
+
+// patternRegexp converts a gitignore style pattern. Patterns containing a slash other than a trailing one are
+// relative to the repository root, others match at any depth. A match also covers everything below it.
+func patternRegexp(pattern string) *regexp.Regexp {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	p := strings.Trim(pattern, "/")
+
+	var re strings.Builder
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case p[i] == '*':
+			re.WriteString("[^/]*")
+		case p[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+
+	prefix := "^(.*/)?"
+	if anchored {
+		prefix = "^"
+	}
+	return regexp.MustCompile(prefix + re.String() + "(/.*)?$")
+}
@@ -0,0 +1,72 @@
+package codeowners
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testCodeowners = `# Default owners
+*                @org/maintainers
+
+/cmd/            @alice
+*.md             @org/docs
+codehost/**/gitlab*.go @bob
+/review/sarif.go @carol @dave
+docs/            # no owners
+
+[Section]
+`
+
+func TestRules_Owners(t *testing.T) {
+	rules := Parse(testCodeowners)
+	testCases := map[string][]string{
+		"main.go":                     {"@org/maintainers"},
+		"cmd/pr.go":                   {"@alice"},
+		"cmd/README.md":               {"@org/docs"},
+		"codehost/gitlab.go":          {"@bob"},
+		"codehost/sub/gitlab_test.go": {"@bob"},
+		"codehost/github.go":          {"@org/maintainers"},
+		"review/sarif.go":             {"@carol", "@dave"},
+		"other/review/sarif.go":       {"@org/maintainers"},
+		"docs/guide.txt":              {},
+	}
+	for path, want := range testCases {
+		got := rules.Owners(path)
+		if len(got) == 0 && len(want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected owners of %s to be %v, but got %v", path, want, got)
+		}
+	}
+}
+
+func TestRules_OwnersNoMatch(t *testing.T) {
+	rules := Parse("/cmd/ @alice\n")
+	if got := rules.Owners("main.go"); got != nil {
+		t.Errorf("Expected no owners, but got %v", got)
+	}
+	if got := rules.Owners("cmd"); !reflect.DeepEqual(got, []string{"@alice"}) {
+		t.Errorf("Expected the directory itself to be owned, but got %v", got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"internal/crypto/", "internal/crypto/aes.go", true},
+		{"internal/crypto/", "other/internal/crypto/aes.go", false},
+		{"customer-data", "a/customer-data/export.csv", true},
+		{"*.pem", "certs/server.pem", true},
+		{"docs/**/*.md", "docs/a/b/c.md", true},
+		{"docs/*.md", "docs/a/c.md", false},
+	}
+	for _, tc := range testCases {
+		if got := Match(tc.pattern, tc.path); got != tc.want {
+			t.Errorf("Expected Match(%q, %q) to be %v, but got %v", tc.pattern, tc.path, tc.want, got)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+
+	"github.com/LarsOL/NeuroSpecation/pathpolicy"
 )
 
 // FileContent represents a file with its name and content.
@@ -47,6 +49,9 @@ func FilterNodes(node fs.DirEntry) bool {
 
 type FilterFunc func(node fs.DirEntry) bool
 
+// withheldSource names the directory walk in the path policy's audit report.
+const withheldSource = "directory contents"
+
 // WalkDirectories traverses a directory tree and performs a custom action on each directory.
 // `root` is the starting directory.
 // `onDir` is a callback function that receives:
@@ -54,7 +59,12 @@ type FilterFunc func(node fs.DirEntry) bool
 // - Files in the directory as a slice of FileContent
 // - Subdirectories as a slice of strings
 func WalkDirectories(root string, onDir func(directory string, files []FileContent, subdirs []string) error, filterNodes FilterFunc) error {
+	return WalkDirectoriesWithPolicy(root, nil, onDir, filterNodes)
+}
 
+// WalkDirectoriesWithPolicy is WalkDirectories for content that is sent to an AI provider. Files and directories the
+// path policy denies are left out, or in its stub mode passed on with a placeholder instead of their content.
+func WalkDirectoriesWithPolicy(root string, policy *pathpolicy.Policy, onDir func(directory string, files []FileContent, subdirs []string) error, filterNodes FilterFunc) error {
 	if filterNodes == nil {
 		filterNodes = FilterNodes
 	}
@@ -75,10 +85,10 @@ func WalkDirectories(root string, onDir func(directory string, files []FileConte
 
 		// Only process directories
 		if info.IsDir() {
-			if !filterNodes(info) {
+			if !filterNodes(info) || policy.WithholdsDir(path, withheldSource) {
 				return filepath.SkipDir
 			}
-			files, subdirs, err := readDirectoryContents(path, filterNodes)
+			files, subdirs, err := readDirectoryContents(path, filterNodes, policy)
 			if err != nil {
 				return fmt.Errorf("error reading directory contents for %s: %w", path, err)
 			}
@@ -91,7 +101,7 @@ func WalkDirectories(root string, onDir func(directory string, files []FileConte
 // readDirectoryContents reads the contents of a directory and returns:
 // - A slice of FileContent for all files in the directory
 // - A slice of strings for all subdirectories
-func readDirectoryContents(dir string, filterNodes FilterFunc) ([]FileContent, []string, error) {
+func readDirectoryContents(dir string, filterNodes FilterFunc, policy *pathpolicy.Policy) ([]FileContent, []string, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error reading directory %s: %w", dir, err)
@@ -104,11 +114,22 @@ func readDirectoryContents(dir string, filterNodes FilterFunc) ([]FileContent, [
 		if !filterNodes(entry) {
 			continue
 		}
+		fullPath := filepath.Join(dir, entry.Name())
 		if entry.IsDir() {
+			if policy.WithholdsDir(fullPath, withheldSource) && policy.Mode() == pathpolicy.ModeOmit {
+				continue
+			}
 			subdirs = append(subdirs, entry.Name())
+		} else if policy.WithholdsFile(fullPath, withheldSource) {
+			if policy.Mode() == pathpolicy.ModeStub {
+				files = append(files, FileContent{
+					Name:    entry.Name(),
+					Content: policy.StubFile(fullPath),
+					Path:    dir,
+				})
+			}
 		} else {
 			// Read file contents
-			fullPath := filepath.Join(dir, entry.Name())
 			content, err := ioutil.ReadFile(fullPath)
 			if err != nil {
 				return nil, nil, fmt.Errorf("error reading file %s: %w", fullPath, err)
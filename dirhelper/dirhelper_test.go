@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/LarsOL/NeuroSpecation/pathpolicy"
 )
 
 // testDirEntry is a helper struct to mock fs.DirEntry for testing
@@ -194,7 +196,7 @@ func TestReadDirectoryContents(t *testing.T) {
 		t.Fatalf("Failed to create file: %v", err)
 	}
 
-	files, subdirs, err := readDirectoryContents(tmpDir, FilterNodes)
+	files, subdirs, err := readDirectoryContents(tmpDir, FilterNodes, nil)
 	if err != nil {
 		t.Fatalf("readDirectoryContents failed: %v", err)
 	}
@@ -216,3 +218,60 @@ func TestReadDirectoryContents(t *testing.T) {
 		t.Errorf("Expected subdir 'subdir', but got %q", subdirs[0])
 	}
 }
+
+func TestWalkDirectoriesWithPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"internal/crypto", "internal/api", "customer-data"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	for _, file := range []string{"main.go", "internal/crypto/aes.go", "internal/api/api.go", "internal/api/keys.yaml", "customer-data/export.yaml"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, file), []byte("secret"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	walk := func(mode pathpolicy.Mode) (map[string]string, map[string][]string, *pathpolicy.Policy) {
+		policy, err := pathpolicy.New(pathpolicy.File{Default: pathpolicy.Rules{
+			Deny: []string{"internal/crypto/", "customer-data/", "*.yaml"},
+			Mode: mode,
+		}}, tmpDir, "openai")
+		if err != nil {
+			t.Fatalf("Failed to create policy: %v", err)
+		}
+		files := map[string]string{}
+		subdirs := map[string][]string{}
+		err = WalkDirectoriesWithPolicy(tmpDir, policy, func(dir string, fc []FileContent, sd []string) error {
+			rel, _ := filepath.Rel(tmpDir, dir)
+			subdirs[rel] = sd
+			for _, f := range fc {
+				files[filepath.ToSlash(filepath.Join(rel, f.Name))] = f.Content
+			}
+			return nil
+		}, nil)
+		if err != nil {
+			t.Fatalf("WalkDirectoriesWithPolicy failed: %v", err)
+		}
+		return files, subdirs, policy
+	}
+
+	files, subdirs, policy := walk(pathpolicy.ModeOmit)
+	if len(files) != 2 || files["main.go"] != "secret" || files["internal/api/api.go"] != "secret" {
+		t.Errorf("Expected only main.go and internal/api/api.go to be read, but got %v", files)
+	}
+	if len(subdirs["."]) != 1 || subdirs["."][0] != "internal" || len(subdirs["internal"]) != 1 {
+		t.Errorf("Expected the denied directories not to be listed, but got %v", subdirs)
+	}
+	if _, ok := subdirs["internal/crypto"]; ok {
+		t.Error("Expected the denied directory not to be walked")
+	}
+	if got := len(policy.Withheld()); got != 3 {
+		t.Errorf("Expected 3 withheld paths, but got %+v", policy.Withheld())
+	}
+
+	files, _, _ = walk(pathpolicy.ModeStub)
+	if files["internal/api/keys.yaml"] != "(content of internal/api/keys.yaml withheld by the path policy for openai)" {
+		t.Errorf("Expected the denied file to be stubbed, but got %v", files)
+	}
+}
@@ -0,0 +1,152 @@
+// Package guidelines holds the coding standards a review enforces: documents such as CONTRIBUTING.md or ADRs, and
+// rules that only apply to some paths.
+package guidelines
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/LarsOL/NeuroSpecation/codeowners"
+	"github.com/spf13/viper"
+)
+
+// FileName is the guidelines file read from the repository root.
+const FileName = ".neurospecation/guidelines.yaml"
+
+// Rule is a guideline stated directly, e.g. that every command in cmd/ must support --dry-run.
+type Rule struct {
+	// ID is cited by the findings enforcing the rule
+	ID string `mapstructure:"id"`
+	// Paths are gitignore style patterns relative to the repository root, the rule applies to every file if empty
+	Paths []string `mapstructure:"paths"`
+	Rule  string   `mapstructure:"rule"`
+}
+
+// Config lists where the guidelines come from.
+type Config struct {
+	// Sources are gitignore style patterns of the documents holding guidelines, e.g. CONTRIBUTING.md or docs/adr/
+	Sources []string `mapstructure:"sources"`
+	Rules   []Rule   `mapstructure:"rules"`
+}
+
+// Parse reads a guidelines file.
+func Parse(content []byte) (Config, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(content)); err != nil {
+		return Config{}, fmt.Errorf("failed to read guidelines: %w", err)
+	}
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to parse guidelines: %w", err)
+	}
+	return cfg, nil
+}
+
+// Merge adds the sources and rules of other.
+func (c Config) Merge(other Config) Config {
+	return Config{
+		Sources: append(slices.Clone(c.Sources), other.Sources...),
+		Rules:   append(slices.Clone(c.Rules), other.Rules...),
+	}
+}
+
+var ruleID = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Validate checks that every rule has a unique kebab-case ID and a text.
+func (c Config) Validate() error {
+	seen := map[string]bool{}
+	for i, r := range c.Rules {
+		if !ruleID.MatchString(r.ID) {
+			return fmt.Errorf("rule %d: id %q must be kebab-case, e.g. cmd-dry-run", i+1, r.ID)
+		}
+		if seen[r.ID] {
+			return fmt.Errorf("rule %s is defined twice", r.ID)
+		}
+		seen[r.ID] = true
+		if strings.TrimSpace(r.Rule) == "" {
+			return fmt.Errorf("rule %s has no text", r.ID)
+		}
+	}
+	return nil
+}
+
+// Applies reports whether the rule covers path, relative to the repository root.
+func (r Rule) Applies(path string) bool {
+	return len(r.Paths) == 0 || slices.ContainsFunc(r.Paths, func(p string) bool { return codeowners.Match(p, path) })
+}
+
+// RulesFor returns the rules covering at least one of the files, in their configured order.
+func (c Config) RulesFor(files []string) []Rule {
+	var rules []Rule
+	for _, r := range c.Rules {
+		if slices.ContainsFunc(files, r.Applies) {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// IsSource reports whether path, relative to the repository root, is a guideline document.
+func (c Config) IsSource(path string) bool {
+	return slices.ContainsFunc(c.Sources, func(p string) bool { return codeowners.Match(p, path) })
+}
+
+// Document is a guideline document and its content.
+type Document struct {
+	Path    string
+	Content string
+}
+
+// Guidelines are what a review is checked against.
+type Guidelines struct {
+	Documents []Document
+	// Rules are the rules covering the changed files
+	Rules []Rule
+}
+
+// Empty reports whether there is nothing to enforce.
+func (g Guidelines) Empty() bool {
+	return len(g.Documents) == 0 && len(g.Rules) == 0
+}
+
+// Add keeps doc if it fits in what is left of budget bytes, returning whether it did. budget <= 0 keeps nothing.
+func (g *Guidelines) Add(doc Document, budget int) bool {
+	used := 0
+	for _, d := range g.Documents {
+		used += len(d.Content)
+	}
+	if used+len(doc.Content) > budget {
+		return false
+	}
+	g.Documents = append(g.Documents, doc)
+	return true
+}
+
+// RulesText lists the rules, one per line, with their ID and paths.
+func (g Guidelines) RulesText() string {
+	var sb strings.Builder
+	for _, r := range g.Rules {
+		sb.WriteString("- " + r.ID)
+		if len(r.Paths) > 0 {
+			sb.WriteString(" (applies to " + strings.Join(r.Paths, ", ") + ")")
+		}
+		sb.WriteString(": " + strings.TrimSpace(r.Rule) + "\n")
+	}
+	return sb.String()
+}
+
+// DocumentsText concatenates the documents, each headed by its path.
+func (g Guidelines) DocumentsText() string {
+	var sb strings.Builder
+	for _, d := range g.Documents {
+		sb.WriteString("File: " + d.Path + "\n" + d.Content)
+		if !strings.HasSuffix(d.Content, "\n") {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
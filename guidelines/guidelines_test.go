@@ -0,0 +1,90 @@
+package guidelines
+
+import (
+	"strings"
+	"testing"
+)
+
+const testFile = `
+sources: ["CONTRIBUTING.md", "docs/adr/"]
+rules:
+  - id: cmd-dry-run
+    paths: ["cmd/"]
+    rule: Every command must support --dry-run.
+  - id: wrap-errors
+    rule: Wrap returned errors with fmt.Errorf and %w.
+`
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(testFile))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(cfg.Sources) != 2 || len(cfg.Rules) != 2 {
+		t.Fatalf("Expected 2 sources and 2 rules, but got %+v", cfg)
+	}
+	if r := cfg.Rules[0]; r.ID != "cmd-dry-run" || len(r.Paths) != 1 || r.Rule != "Every command must support --dry-run." {
+		t.Errorf("Expected the cmd-dry-run rule, but got %+v", r)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected the rules to be valid, but got %v", err)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	testCases := map[string][]Rule{
+		"missing id":   {{Rule: "Use slog."}},
+		"invalid id":   {{ID: "Use Slog", Rule: "Use slog."}},
+		"duplicate id": {{ID: "slog", Rule: "Use slog."}, {ID: "slog", Rule: "Use slog for logs."}},
+		"missing text": {{ID: "slog", Rule: " "}},
+	}
+	for name, rules := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if err := (Config{Rules: rules}).Validate(); err == nil {
+				t.Errorf("Expected %+v to be rejected, but got nil", rules)
+			}
+		})
+	}
+}
+
+func TestConfig_RulesFor(t *testing.T) {
+	cfg, err := Parse([]byte(testFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		files []string
+		want  []string
+	}{
+		{[]string{"cmd/pr.go"}, []string{"cmd-dry-run", "wrap-errors"}},
+		{[]string{"review/review.go"}, []string{"wrap-errors"}},
+		{nil, nil},
+	}
+	for _, tc := range testCases {
+		var got []string
+		for _, r := range cfg.RulesFor(tc.files) {
+			got = append(got, r.ID)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("Expected rules %v for %v, but got %v", tc.want, tc.files, got)
+		}
+	}
+
+	if !cfg.IsSource("docs/adr/0001-logging.md") || cfg.IsSource("docs/guide.md") {
+		t.Error("Expected only the configured documents to be sources")
+	}
+}
+
+func TestGuidelines_Add(t *testing.T) {
+	var g Guidelines
+	if !g.Add(Document{Path: "CONTRIBUTING.md", Content: "Use slog."}, 20) {
+		t.Error("Expected the first document to fit")
+	}
+	if g.Add(Document{Path: "STYLE.md", Content: "Wrap every error."}, 20) {
+		t.Error("Expected the second document to exceed the budget")
+	}
+	want := "File: CONTRIBUTING.md\nUse slog.\n"
+	if got := g.DocumentsText(); got != want {
+		t.Errorf("Expected %q, but got %q", want, got)
+	}
+}
@@ -0,0 +1,372 @@
+// Package pathpolicy decides which repository paths may be sent to an AI provider, and records what was withheld.
+package pathpolicy
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/LarsOL/NeuroSpecation/codeowners"
+	"github.com/spf13/viper"
+)
+
+// FileName is the policy file read from the repository root by default.
+const FileName = ".neurospecation-paths.yaml"
+
+// Mode is what is sent in place of a withheld file.
+type Mode string
+
+const (
+	// ModeOmit leaves withheld files out entirely.
+	ModeOmit Mode = "omit"
+	// ModeStub keeps a note that the file exists, without its content.
+	ModeStub Mode = "stub"
+)
+
+// Rules are the paths one provider may see. Patterns are gitignore style, relative to the repository root.
+type Rules struct {
+	// Allow, if not empty, only lets through paths matching one of its patterns
+	Allow []string `mapstructure:"allow"`
+	// Deny withholds paths matching one of its patterns, even if they are allowed
+	Deny []string `mapstructure:"deny"`
+	Mode Mode     `mapstructure:"mode"`
+}
+
+// File is the content of the policy file. A provider listed under Providers uses its own rules instead of the
+// default ones, e.g. a local model may be given no rules at all.
+type File struct {
+	Default   Rules            `mapstructure:"default"`
+	Providers map[string]Rules `mapstructure:"providers"`
+}
+
+// ruleNotAllowed is the rule of paths withheld because no allow pattern matched them.
+const ruleNotAllowed = "not allowed"
+
+// ruleUnparsed is the rule of diff sections withheld because their paths could not be read.
+const ruleUnparsed = "unparsable diff header"
+
+// Withheld is a path that was not sent.
+type Withheld struct {
+	Path string `json:"path"`
+	// Rule is the pattern that denied the path, or "not allowed" when no allow pattern matched
+	Rule string `json:"rule"`
+	Mode Mode   `json:"mode"`
+	// Source is where the path would have been sent from, e.g. the diff or the knowledge base
+	Source string `json:"source"`
+}
+
+// Policy enforces the rules of one provider. A nil Policy allows everything.
+type Policy struct {
+	root     string
+	provider string
+	rules    Rules
+
+	mu       sync.Mutex
+	withheld map[string]Withheld
+}
+
+// Load reads the policy file for provider, returning nil if the file does not exist.
+// root is the repository root the patterns are relative to.
+func Load(path, root, provider string) (*Policy, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read path policy %s: %w", path, err)
+	}
+	return Parse(content, path, root, provider)
+}
+
+// Parse reads the policy for provider from the content of a policy file, origin names it in errors.
+func Parse(content []byte, origin, root, provider string) (*Policy, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(content)); err != nil {
+		return nil, fmt.Errorf("failed to read path policy %s: %w", origin, err)
+	}
+	var file File
+	if err := v.Unmarshal(&file); err != nil {
+		return nil, fmt.Errorf("failed to parse path policy %s: %w", origin, err)
+	}
+	// Unmarshal drops providers without any rules, which are the ones that may see everything
+	for name := range v.GetStringMap("providers") {
+		if _, ok := file.Providers[name]; !ok {
+			if file.Providers == nil {
+				file.Providers = map[string]Rules{}
+			}
+			file.Providers[name] = Rules{}
+		}
+	}
+	return New(file, root, provider)
+}
+
+// New applies the rules of provider from file.
+func New(file File, root, provider string) (*Policy, error) {
+	rules := file.Default
+	for name, r := range file.Providers {
+		// Keys are case-insensitive, as in the rest of the configuration
+		if strings.EqualFold(name, provider) {
+			rules = r
+		}
+	}
+	switch rules.Mode {
+	case "":
+		rules.Mode = ModeOmit
+	case ModeOmit, ModeStub:
+	default:
+		return nil, fmt.Errorf("unknown path policy mode %q, expected %s or %s", rules.Mode, ModeOmit, ModeStub)
+	}
+	return &Policy{root: root, provider: provider, rules: rules, withheld: map[string]Withheld{}}, nil
+}
+
+// Provider is the provider the policy applies to.
+func (p *Policy) Provider() string {
+	if p == nil {
+		return ""
+	}
+	return p.provider
+}
+
+// Mode is what is sent in place of withheld files.
+func (p *Policy) Mode() Mode {
+	if p == nil {
+		return ModeOmit
+	}
+	return p.rules.Mode
+}
+
+// Check returns whether path, relative to the repository root, may be sent, and the rule withholding it if not.
+func (p *Policy) Check(path string) (bool, string) {
+	if p == nil {
+		return true, ""
+	}
+	path = strings.TrimPrefix(filepath.ToSlash(path), "/")
+	for _, pattern := range p.rules.Deny {
+		if codeowners.Match(pattern, path) {
+			return false, pattern
+		}
+	}
+	if len(p.rules.Allow) > 0 && !slices.ContainsFunc(p.rules.Allow, func(pattern string) bool { return codeowners.Match(pattern, path) }) {
+		return false, ruleNotAllowed
+	}
+	return true, ""
+}
+
+// Withholds reports whether path, relative to the repository root, must not be sent, and records it if so.
+func (p *Policy) Withholds(path, source string) bool {
+	ok, rule := p.Check(path)
+	if ok {
+		return false
+	}
+	p.record(strings.TrimPrefix(filepath.ToSlash(path), "/"), rule, source)
+	return true
+}
+
+// record adds path to the withheld paths.
+func (p *Policy) record(path, rule, source string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, seen := p.withheld[path]; !seen {
+		p.withheld[path] = Withheld{Path: path, Rule: rule, Mode: p.rules.Mode, Source: source}
+	}
+}
+
+// WithholdsFile is Withholds for a path on disk, which is made relative to the repository root first.
+func (p *Policy) WithholdsFile(path, source string) bool {
+	if p == nil {
+		return false
+	}
+	return p.Withholds(p.rel(path), source)
+}
+
+// WithholdsDir reports whether a directory on disk is denied as a whole, and records it if so.
+// Allow patterns are not applied, as they may still match files below the directory.
+func (p *Policy) WithholdsDir(path, source string) bool {
+	if p == nil {
+		return false
+	}
+	rel := p.rel(path)
+	if rel == "." {
+		return false
+	}
+	if ok, rule := p.Check(rel); ok || rule == ruleNotAllowed {
+		return false
+	}
+	return p.Withholds(rel, source)
+}
+
+// rel makes a path on disk relative to the repository root. Paths outside the repository are returned as given.
+func (p *Policy) rel(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	root, err := filepath.Abs(p.root)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// Stub is sent in place of a withheld file's content in ModeStub.
+func (p *Policy) Stub(path string) string {
+	return fmt.Sprintf("(content of %s withheld by the path policy for %s)", filepath.ToSlash(path), p.Provider())
+}
+
+// StubFile is Stub for a path on disk.
+func (p *Policy) StubFile(path string) string {
+	return p.Stub(p.rel(path))
+}
+
+// Withheld lists the withheld paths, sorted by path.
+func (p *Policy) Withheld() []Withheld {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := make([]Withheld, 0, len(p.withheld))
+	for _, w := range p.withheld {
+		list = append(list, w)
+	}
+	slices.SortFunc(list, func(a, b Withheld) int { return cmp.Compare(a.Path, b.Path) })
+	return list
+}
+
+// FilterDiff withholds the files of a git diff the policy denies, by their path before or after the change.
+// Files whose header cannot be parsed are withheld too, as their paths cannot be checked.
+func (p *Policy) FilterDiff(diff, source string) string {
+	if p == nil || diff == "" {
+		return diff
+	}
+	var sb strings.Builder
+	for _, section := range splitDiff(diff) {
+		header, _, _ := strings.Cut(section, "\n")
+		paths, ok := diffPaths(header)
+		path, denied := "", false
+		if !ok {
+			path, denied = strings.TrimPrefix(header, "diff --git "), true
+			p.record(path, ruleUnparsed, source)
+		}
+		for _, candidate := range paths {
+			if p.Withholds(candidate, source) {
+				path, denied = candidate, true
+				break
+			}
+		}
+		switch {
+		case !denied:
+			sb.WriteString(section)
+		case p.rules.Mode == ModeStub:
+			sb.WriteString(header + "\n" + p.Stub(path) + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// splitDiff cuts a git diff into one section per file, each starting with its "diff --git" line.
+func splitDiff(diff string) []string {
+	var sections []string
+	start := 0
+	for {
+		next := strings.Index(diff[start+1:], "\ndiff --git ")
+		if next < 0 {
+			return append(sections, diff[start:])
+		}
+		end := start + 1 + next + 1
+		sections = append(sections, diff[start:end])
+		start = end
+	}
+}
+
+// diffPaths returns the paths before and after the change from a "diff --git a/x b/y" line. Git quotes paths with
+// special or non-ASCII characters C-style, e.g. "a/na\303\257ve.csv".
+func diffPaths(header string) ([]string, bool) {
+	rest, ok := strings.CutPrefix(header, "diff --git ")
+	if !ok {
+		return nil, false
+	}
+	var before string
+	if strings.HasPrefix(rest, `"`) {
+		before, rest, ok = unquotePath(rest)
+	} else {
+		// An unquoted path ends where the second one starts, spaces are not quoted
+		i := strings.Index(rest, " b/")
+		if j := strings.Index(rest, ` "b/`); j >= 0 && (i < 0 || j < i) {
+			i = j
+		}
+		if i < 0 {
+			return nil, false
+		}
+		before, rest = rest[:i], rest[i:]
+	}
+	if !ok {
+		return nil, false
+	}
+	rest, ok = strings.CutPrefix(rest, " ")
+	if !ok {
+		return nil, false
+	}
+	after := rest
+	if strings.HasPrefix(rest, `"`) {
+		after, rest, ok = unquotePath(rest)
+		if !ok || rest != "" {
+			return nil, false
+		}
+	}
+	before, okBefore := strings.CutPrefix(before, "a/")
+	after, okAfter := strings.CutPrefix(after, "b/")
+	if !okBefore || !okAfter {
+		return nil, false
+	}
+	return []string{before, after}, true
+}
+
+// NewFilePath returns the path after the change from a "+++ b/x" file header, quoted or not, and "" for a deleted
+// file.
+func NewFilePath(header string) (string, bool) {
+	rest, ok := strings.CutPrefix(header, "+++ ")
+	if !ok {
+		return "", false
+	}
+	if rest == "/dev/null" {
+		return "", true
+	}
+	if strings.HasPrefix(rest, `"`) {
+		var tail string
+		rest, tail, ok = unquotePath(rest)
+		if !ok || tail != "" {
+			return "", false
+		}
+	}
+	path, ok := strings.CutPrefix(rest, "b/")
+	if !ok {
+		return "", false
+	}
+	return path, true
+}
+
+// unquotePath reads the quoted path at the start of s, returning it and the rest of s.
+func unquotePath(s string) (string, string, bool) {
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", false
+	}
+	path, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", "", false
+	}
+	return path, s[len(quoted):], true
+}
@@ -0,0 +1,208 @@
+package pathpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testDiff = `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1 +1 @@
+-package old
++package main
+diff --git a/internal/crypto/aes.go b/internal/crypto/aes.go
+--- a/internal/crypto/aes.go
++++ b/internal/crypto/aes.go
+@@ -1 +1 @@
+-key := 1
++key := 2
+diff --git a/export.go b/customer-data/export.go
+similarity index 90%
+rename from export.go
+rename to customer-data/export.go
+`
+
+func testFile() File {
+	return File{
+		Default: Rules{Deny: []string{"internal/crypto/", "customer-data/"}},
+		Providers: map[string]Rules{
+			"local":   {},
+			"stubbed": {Deny: []string{"internal/crypto/"}, Mode: ModeStub},
+			"allow":   {Allow: []string{"*.go"}, Deny: []string{"main.go"}},
+		},
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	p, err := New(testFile(), "", "openai")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	testCases := map[string]string{
+		"main.go":                      "",
+		"internal/crypto/aes.go":       "internal/crypto/",
+		"/internal/crypto/sub/x.go":    "internal/crypto/",
+		"customer-data/2024/users.csv": "customer-data/",
+		"internal/cryptography.go":     "",
+	}
+	for path, wantRule := range testCases {
+		ok, rule := p.Check(path)
+		if ok != (wantRule == "") || rule != wantRule {
+			t.Errorf("Expected Check(%s) to be withheld by %q, but got allowed=%v rule=%q", path, wantRule, ok, rule)
+		}
+	}
+
+	allow, err := New(testFile(), "", "ALLOW")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if ok, rule := allow.Check("README.md"); ok || rule != "not allowed" {
+		t.Errorf("Expected paths outside the allow list to be withheld, but got allowed=%v rule=%q", ok, rule)
+	}
+	if ok, rule := allow.Check("main.go"); ok || rule != "main.go" {
+		t.Errorf("Expected deny to win over allow, but got allowed=%v rule=%q", ok, rule)
+	}
+
+	local, err := New(testFile(), "", "local")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if ok, _ := local.Check("internal/crypto/aes.go"); !ok {
+		t.Error("Expected a provider without rules to see everything")
+	}
+
+	var none *Policy
+	if ok, _ := none.Check("internal/crypto/aes.go"); !ok || none.Withholds("internal/crypto/aes.go", "diff") {
+		t.Error("Expected a nil policy to allow everything")
+	}
+}
+
+func TestNew_InvalidMode(t *testing.T) {
+	if _, err := New(File{Default: Rules{Mode: "redact"}}, "", "openai"); err == nil {
+		t.Error("Expected an error for an unknown mode, but got nil")
+	}
+}
+
+func TestPolicy_FilterDiff(t *testing.T) {
+	p, err := New(testFile(), "", "openai")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	got := p.FilterDiff(testDiff, "diff")
+	want := "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-package old\n+package main\n"
+	if got != want {
+		t.Errorf("Expected the denied files to be omitted, but got:\n%s", got)
+	}
+	wantWithheld := []Withheld{
+		{Path: "customer-data/export.go", Rule: "customer-data/", Mode: ModeOmit, Source: "diff"},
+		{Path: "internal/crypto/aes.go", Rule: "internal/crypto/", Mode: ModeOmit, Source: "diff"},
+	}
+	if !reflect.DeepEqual(p.Withheld(), wantWithheld) {
+		t.Errorf("Expected withheld %+v, but got %+v", wantWithheld, p.Withheld())
+	}
+
+	stubbed, err := New(testFile(), "", "stubbed")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	got = stubbed.FilterDiff(testDiff, "diff")
+	want = "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-package old\n+package main\n" +
+		"diff --git a/internal/crypto/aes.go b/internal/crypto/aes.go\n(content of internal/crypto/aes.go withheld by the path policy for stubbed)\n" +
+		"diff --git a/export.go b/customer-data/export.go\nsimilarity index 90%\nrename from export.go\nrename to customer-data/export.go\n"
+	if got != want {
+		t.Errorf("Expected the denied file to be stubbed, but got:\n%s", got)
+	}
+}
+
+func TestPolicy_FilterDiffQuoted(t *testing.T) {
+	p, err := New(testFile(), "", "openai")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	diff := "diff --git \"a/customer-data/na\\303\\257ve.csv\" \"b/customer-data/na\\303\\257ve.csv\"\n@@ -1 +1 @@\n-a\n+b\n" +
+		"diff --git a/docs/my notes.md \"b/docs/\\303\\251t\\303\\251.md\"\nrename from docs/my notes.md\n" +
+		"diff --git garbage\n@@ -1 +1 @@\n-secret\n"
+	got := p.FilterDiff(diff, "diff")
+	want := "diff --git a/docs/my notes.md \"b/docs/\\303\\251t\\303\\251.md\"\nrename from docs/my notes.md\n"
+	if got != want {
+		t.Errorf("Expected the denied quoted file and the unparsable section to be omitted, but got:\n%s", got)
+	}
+	wantWithheld := []Withheld{
+		{Path: "customer-data/naïve.csv", Rule: "customer-data/", Mode: ModeOmit, Source: "diff"},
+		{Path: "garbage", Rule: ruleUnparsed, Mode: ModeOmit, Source: "diff"},
+	}
+	if !reflect.DeepEqual(p.Withheld(), wantWithheld) {
+		t.Errorf("Expected withheld %+v, but got %+v", wantWithheld, p.Withheld())
+	}
+}
+
+func TestDiffPaths(t *testing.T) {
+	testCases := map[string][]string{
+		"diff --git a/main.go b/main.go":                     {"main.go", "main.go"},
+		"diff --git a/my file.go b/my file.go":               {"my file.go", "my file.go"},
+		`diff --git "a/na\303\257ve.go" "b/na\303\257ve.go"`: {"naïve.go", "naïve.go"},
+		`diff --git "a/tab\there.go" b/tab.go`:               {"tab\there.go", "tab.go"},
+		"diff --git a/main.go":                               nil,
+		`diff --git "a/unterminated b/x`:                     nil,
+	}
+	for header, want := range testCases {
+		got, ok := diffPaths(header)
+		if ok != (want != nil) || !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %q to give %q, but got %q (%v)", header, want, got, ok)
+		}
+	}
+}
+
+func TestNewFilePath(t *testing.T) {
+	testCases := map[string]struct {
+		path string
+		ok   bool
+	}{
+		"+++ b/main.go":           {"main.go", true},
+		"+++ b/my file.go":        {"my file.go", true},
+		`+++ "b/na\303\257ve.go"`: {"naïve.go", true},
+		"+++ /dev/null":           {"", true},
+		"+++ main.go":             {"", false},
+		`+++ "b/unterminated`:     {"", false},
+		"--- a/main.go":           {"", false},
+	}
+	for header, want := range testCases {
+		path, ok := NewFilePath(header)
+		if path != want.path || ok != want.ok {
+			t.Errorf("Expected %q to give %q (%v), but got %q (%v)", header, want.path, want.ok, path, ok)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	root := t.TempDir()
+	if p, err := Load(filepath.Join(root, FileName), root, "openai"); p != nil || err != nil {
+		t.Errorf("Expected no policy without a file, but got %v, %v", p, err)
+	}
+
+	content := "default:\n  deny: [\"secrets/\"]\n  mode: stub\nproviders:\n  Local: {}\n"
+	if err := os.WriteFile(filepath.Join(root, FileName), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Load(filepath.Join(root, FileName), root, "openai")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if p.Mode() != ModeStub || !p.WithholdsFile(filepath.Join(root, "secrets", "prod.env"), "knowledge base") {
+		t.Errorf("Expected files under secrets/ to be stubbed, but got mode %s and %+v", p.Mode(), p.Withheld())
+	}
+	if got := p.Withheld(); len(got) != 1 || got[0].Path != "secrets/prod.env" {
+		t.Errorf("Expected the file to be recorded relative to the root, but got %+v", got)
+	}
+
+	local, err := Load(filepath.Join(root, FileName), root, "local")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if local.WithholdsFile(filepath.Join(root, "secrets", "prod.env"), "knowledge base") {
+		t.Error("Expected the local provider to see everything")
+	}
+}
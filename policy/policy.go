@@ -0,0 +1,120 @@
+// Package policy decides whether a pull request is worth a full review, a light one, or none at all.
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Action is what to do with a pull request.
+type Action string
+
+const (
+	// ActionReview runs every configured pipeline with the default model.
+	ActionReview Action = "review"
+	// ActionLight only reviews the change, with the small model if one is configured.
+	ActionLight Action = "light"
+	// ActionSkip does not review the change.
+	ActionSkip Action = "skip"
+)
+
+// Config holds the review policy. Zero values disable a rule.
+type Config struct {
+	SkipDrafts bool
+	// SkipAuthors and LightAuthors are globs, "*" matches any run of characters and "?" a single one
+	SkipAuthors     []string
+	SkipLabels      []string
+	MinChangedLines int
+	MaxChangedLines int
+	MaxChangedFiles int
+	LightAuthors    []string
+	LightLabels     []string
+	// LightMaxLines gives changes of at most this many lines a light review
+	LightMaxLines int
+}
+
+// Change describes the pull request the policy is applied to.
+type Change struct {
+	Author string
+	Draft  bool
+	Labels []string
+	Lines  int
+	Files  int
+}
+
+// Decision is the outcome of the policy, with the rule that caused it.
+type Decision struct {
+	Action Action
+	Reason string
+}
+
+// Decide applies the rules in order: skip rules first, then light review rules.
+func Decide(cfg Config, c Change) Decision {
+	switch {
+	case cfg.SkipDrafts && c.Draft:
+		return Decision{ActionSkip, "draft pull request, it is reviewed once marked ready"}
+	case matchAny(cfg.SkipAuthors, c.Author):
+		return Decision{ActionSkip, fmt.Sprintf("author %s matches the skipped authors", c.Author)}
+	case hasLabel(cfg.SkipLabels, c.Labels) != "":
+		return Decision{ActionSkip, fmt.Sprintf("labelled %s", hasLabel(cfg.SkipLabels, c.Labels))}
+	case cfg.MinChangedLines > 0 && c.Lines < cfg.MinChangedLines:
+		return Decision{ActionSkip, fmt.Sprintf("%d changed lines is below the minimum of %d", c.Lines, cfg.MinChangedLines)}
+	case cfg.MaxChangedLines > 0 && c.Lines > cfg.MaxChangedLines:
+		return Decision{ActionSkip, fmt.Sprintf("%d changed lines is above the maximum of %d", c.Lines, cfg.MaxChangedLines)}
+	case cfg.MaxChangedFiles > 0 && c.Files > cfg.MaxChangedFiles:
+		return Decision{ActionSkip, fmt.Sprintf("%d changed files is above the maximum of %d", c.Files, cfg.MaxChangedFiles)}
+	case matchAny(cfg.LightAuthors, c.Author):
+		return Decision{ActionLight, fmt.Sprintf("author %s matches the light review authors", c.Author)}
+	case hasLabel(cfg.LightLabels, c.Labels) != "":
+		return Decision{ActionLight, fmt.Sprintf("labelled %s", hasLabel(cfg.LightLabels, c.Labels))}
+	case cfg.LightMaxLines > 0 && c.Lines <= cfg.LightMaxLines:
+		return Decision{ActionLight, fmt.Sprintf("%d changed lines is at most %d", c.Lines, cfg.LightMaxLines)}
+	}
+	return Decision{ActionReview, "no policy rule matched"}
+}
+
+// DiffStats counts the changed files and the added and removed lines of a git diff. The "---" and "+++" file headers
+// are only skipped before a file's first hunk, inside a hunk they are changed lines.
+func DiffStats(diff string) (lines, files int) {
+	inHunk := false
+	for _, l := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(l, "diff --git"):
+			files++
+			inHunk = false
+		case strings.HasPrefix(l, "@@"):
+			inHunk = true
+		case !inHunk:
+		case strings.HasPrefix(l, "+"), strings.HasPrefix(l, "-"):
+			lines++
+		}
+	}
+	return lines, files
+}
+
+func matchAny(globs []string, s string) bool {
+	if s == "" {
+		return false
+	}
+	return slices.ContainsFunc(globs, func(g string) bool { return matchGlob(g, s) })
+}
+
+// matchGlob matches case-insensitively. Brackets are literal, bot accounts are named like "renovate[bot]".
+func matchGlob(glob, s string) bool {
+	re := regexp.QuoteMeta(glob)
+	re = strings.ReplaceAll(re, `\*`, ".*")
+	re = strings.ReplaceAll(re, `\?`, ".")
+	return regexp.MustCompile("(?i)^" + re + "$").MatchString(s)
+}
+
+// hasLabel returns the first label that is in both lists, compared case-insensitively.
+func hasLabel(want, labels []string) string {
+	for _, l := range labels {
+		if slices.ContainsFunc(want, func(w string) bool { return strings.EqualFold(w, l) }) {
+			return l
+		}
+	}
+	return ""
+}
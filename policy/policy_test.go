@@ -0,0 +1,57 @@
+package policy
+
+import "testing"
+
+func TestDecide(t *testing.T) {
+	cfg := Config{
+		SkipDrafts:      true,
+		SkipAuthors:     []string{"renovate[bot]", "*-bot"},
+		SkipLabels:      []string{"no-ai-review"},
+		MaxChangedLines: 1000,
+		MaxChangedFiles: 50,
+		LightAuthors:    []string{"dependabot[bot]"},
+		LightMaxLines:   10,
+	}
+	testCases := map[string]struct {
+		change Change
+		want   Action
+	}{
+		"regular":         {Change{Author: "alice", Lines: 200, Files: 5}, ActionReview},
+		"draft":           {Change{Author: "alice", Draft: true, Lines: 200, Files: 5}, ActionSkip},
+		"bot author":      {Change{Author: "Renovate[bot]", Lines: 200, Files: 5}, ActionSkip},
+		"glob author":     {Change{Author: "deploy-bot", Lines: 200, Files: 5}, ActionSkip},
+		"bracket literal": {Change{Author: "renovateb", Lines: 200, Files: 5}, ActionReview},
+		"skip label":      {Change{Author: "alice", Labels: []string{"docs", "No-AI-Review"}, Lines: 200, Files: 5}, ActionSkip},
+		"too many lines":  {Change{Author: "alice", Lines: 1001, Files: 5}, ActionSkip},
+		"too many files":  {Change{Author: "alice", Lines: 200, Files: 51}, ActionSkip},
+		"light author":    {Change{Author: "dependabot[bot]", Lines: 200, Files: 5}, ActionLight},
+		"small change":    {Change{Author: "alice", Lines: 3, Files: 1}, ActionLight},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := Decide(cfg, tc.change)
+			if got.Action != tc.want {
+				t.Errorf("Expected %s, but got %s (%s)", tc.want, got.Action, got.Reason)
+			}
+			if got.Reason == "" {
+				t.Error("Expected a reason for the decision")
+			}
+		})
+	}
+}
+
+func TestDiffStats(t *testing.T) {
+	diff := "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1,2 +1,2 @@\n-old\n+new\n context\n" +
+		"diff --git a/b.go b/b.go\n--- /dev/null\n+++ b/b.go\n@@ -0,0 +1 @@\n+added\n"
+	lines, files := DiffStats(diff)
+	if lines != 3 || files != 2 {
+		t.Errorf("Expected 3 lines in 2 files, but got %d lines in %d files", lines, files)
+	}
+
+	// A removed "-- comment" line and an added "++ counter" line look like file headers
+	diff = "diff --git a/q.sql b/q.sql\n--- a/q.sql\n+++ b/q.sql\n@@ -1,2 +1,2 @@\n--- old comment\n+++ new comment\n SELECT 1;\n"
+	lines, files = DiffStats(diff)
+	if lines != 2 || files != 1 {
+		t.Errorf("Expected 2 lines in 1 file, but got %d lines in %d files", lines, files)
+	}
+}
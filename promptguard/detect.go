@@ -0,0 +1,132 @@
+package promptguard
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/LarsOL/NeuroSpecation/review"
+)
+
+// injectionPattern is a kind of text that tries to instruct the model rather than describe the change.
+type injectionPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+var injectionPatterns = []injectionPattern{
+	{"overrides instructions", regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\b.{0,30}\b(previous|prior|above|earlier|preceding|all|any|your|system)\b.{0,20}\b(instructions?|prompts?|rules|directions|guidelines)\b`)},
+	{"changes the model's role", regexp.MustCompile(`(?i)\byou are (now|no longer)\b|\bfrom now on,? you\b|\bact as (an?|the) .{0,30}\b(ai|assistant|model|reviewer)\b`)},
+	{"addresses the AI reviewer", regexp.MustCompile(`(?i)\b(note|message|instructions?)\s+(to|for)\s+(the\s+)?(ai|llm|gpt|assistant|language model|ai reviewer|review bot)\b`)},
+	{"suppresses findings", regexp.MustCompile(`(?i)\b(do not|don't|never)\s+(report|mention|flag|comment on|point out)\b.{0,30}\b(issues?|problems?|findings?|bugs?|vulnerabilit(y|ies)|credentials?|secrets?|passwords?|keys?|this)\b`)},
+	{"dictates the verdict", regexp.MustCompile(`(?i)\b(say|respond|reply|answer|output|state|conclude)\b.{0,20}\b(lgtm|approved?|looks good|no (issues|problems|findings))\b`)},
+	{"asks for the prompt", regexp.MustCompile(`(?i)\b(reveal|print|show|repeat|leak)\b.{0,20}\b(system prompt|your (instructions|prompt)|the prompt)\b`)},
+	{"contains prompt markup", regexp.MustCompile(`(?i)<\|im_(start|end)\|>|\[/?INST\]|<</?SYS>>|</?(system|assistant)>|^\s*[+-]?\s*(system|assistant)\s*:\s`)},
+	{"imitates the prompt delimiters", regexp.MustCompile(`(?i)<<<\s*(end\s+)?untrusted\b`)},
+	{"contains invisible characters", regexp.MustCompile(`[\x{200B}-\x{200F}\x{202A}-\x{202E}\x{2066}-\x{2069}\x{E0000}-\x{E007F}]`)},
+}
+
+// Warning is text that looks like a prompt injection.
+type Warning struct {
+	// Source is the file or the part of the pull request the text is in
+	Source string
+	// Line is the line within the source, 0 when unknown
+	Line int
+	// Reason describes the pattern that matched
+	Reason string
+	Text   string
+}
+
+// Location is the source, with the line if known.
+func (w Warning) Location() string {
+	if w.Line > 0 {
+		return w.Source + ":" + strconv.Itoa(w.Line)
+	}
+	return w.Source
+}
+
+// Detect flags the lines of text that look like a prompt injection.
+func Detect(source, text string) []Warning {
+	var warnings []Warning
+	for i, line := range strings.Split(text, "\n") {
+		warnings = append(warnings, detectLine(source, i+1, line)...)
+	}
+	return warnings
+}
+
+// DetectDiff flags the lines a git diff adds that look like a prompt injection. The "---" and "+++" file headers are
+// only recognised before a file's first hunk, inside a hunk they are removed or added lines.
+func DetectDiff(diff string) []Warning {
+	var warnings []Warning
+	var file string
+	newLine := 0
+	inHunk := false
+	for _, l := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(l, "diff --git"):
+			file, newLine, inHunk = "", 0, false
+		case !inHunk && strings.HasPrefix(l, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(l, "+++ "), "b/")
+		case !inHunk && strings.HasPrefix(l, "--- "):
+		case strings.HasPrefix(l, "@@"):
+			newLine = review.HunkStart(l)
+			inHunk = true
+		case newLine == 0 || file == "" || file == "/dev/null":
+			continue
+		case strings.HasPrefix(l, "+"):
+			warnings = append(warnings, detectLine(file, newLine, strings.TrimPrefix(l, "+"))...)
+			newLine++
+		case strings.HasPrefix(l, " "):
+			newLine++
+		}
+	}
+	return warnings
+}
+
+func detectLine(source string, line int, text string) []Warning {
+	for _, p := range injectionPatterns {
+		if p.re.MatchString(text) {
+			// One warning per line is enough to draw attention to it
+			return []Warning{{Source: source, Line: line, Reason: p.name, Text: strings.TrimSpace(text)}}
+		}
+	}
+	return nil
+}
+
+// maxListedWarnings keeps the warning short when a change is full of matches.
+const maxListedWarnings = 10
+
+// Summary renders the warnings as a Markdown alert for the review output, or "" when there are none.
+func Summary(warnings []Warning) string {
+	if len(warnings) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("> [!WARNING]\n> **Possible prompt injection.** The following content reads like instructions to the AI reviewer. " +
+		"It was treated as data, but check that this review was not influenced by it.\n>\n")
+	for i, w := range warnings {
+		if i == maxListedWarnings {
+			sb.WriteString(fmt.Sprintf("> - and %d more\n", len(warnings)-maxListedWarnings))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("> - `%s` %s: %s\n", w.Location(), w.Reason, quote(w.Text)))
+	}
+	return sb.String()
+}
+
+// quote shows text in an inline code span, visibly and without letting it break out of the span.
+func quote(text string) string {
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 0x200B && r <= 0x200F, r >= 0x202A && r <= 0x202E, r >= 0x2066 && r <= 0x2069, r >= 0xE0000 && r <= 0xE007F:
+			return '?'
+		}
+		return r
+	}, text)
+	text = strings.ReplaceAll(text, "`", "'")
+	if r := []rune(text); len(r) > 120 {
+		text = string(r[:120]) + "…"
+	}
+	return "`" + text + "`"
+}
@@ -0,0 +1,227 @@
+// Package prompts holds the prompt templates, which users can override per repository or in the config.
+//
+// A template is a text/template with a "system" block holding the instructions, sent in the system role, while the
+// template itself renders the user message. Everything in Data is untrusted and must be passed through the data
+// function, which wraps it in the prompt's delimiter: {{data "diff" .Diff}}. include renders a named block to a
+// string, so several fields can be wrapped together: {{data "directory" (include "listing" .)}}.
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/LarsOL/NeuroSpecation/promptguard"
+)
+
+// The names of the templates.
+const (
+	Knowledgebase = "knowledgebase"
+	Readme        = "readme"
+	Review        = "review"
+	Description   = "description"
+)
+
+// Names lists all templates.
+var Names = []string{Knowledgebase, Readme, Review, Description}
+
+// Dir is where a repository keeps its templates, relative to its root, as <name>.tmpl.
+const Dir = ".neurospecation/prompts"
+
+// originEmbedded is the origin of the built-in templates.
+const originEmbedded = "built-in"
+
+//go:embed templates/*.tmpl
+var embedded embed.FS
+
+// Data is what the templates are rendered with. All of it comes from the repository or pull request.
+type Data struct {
+	// Dir is the directory being summarised, for the knowledgebase template
+	Dir string
+	// Files are the files of Dir, or the ai_knowledge.yaml files for the readme template
+	Files   []File
+	Subdirs []string
+	// PR is nil when not reviewing a pull request
+	PR *PR
+	// Diff is the git diff under review
+	Diff string
+	// Knowledge holds the ai_knowledge.yaml files of the directories the diff touches
+	Knowledge string
+	// CodeContext holds the Go declarations around the changes and the code referencing changed symbols
+	CodeContext string
+}
+
+// File is a file and its content.
+type File struct {
+	Name    string
+	Content string
+}
+
+// PR describes the pull request under review.
+type PR struct {
+	Number int
+	Title  string
+	Body   string
+	Author string
+	Labels []string
+}
+
+// Override looks up a user template by name. It returns an error matching fs.ErrNotExist when it has none, and
+// otherwise the content and where it came from.
+type Override func(name string) (content []byte, origin string, err error)
+
+// FromDir reads <name>.tmpl from dir.
+func FromDir(dir string) Override {
+	return func(name string) ([]byte, string, error) {
+		path := filepath.Join(dir, name+".tmpl")
+		content, err := os.ReadFile(path)
+		return content, path, err
+	}
+}
+
+// FromFiles reads the file configured for each name.
+func FromFiles(files map[string]string) Override {
+	return func(name string) ([]byte, string, error) {
+		path, ok := files[name]
+		if !ok || path == "" {
+			return nil, "", fs.ErrNotExist
+		}
+		content, err := os.ReadFile(path)
+		return content, path, err
+	}
+}
+
+// Template is a parsed prompt template.
+type Template struct {
+	Name string
+	// Origin is the file the template was read from, or "built-in"
+	Origin string
+	Source string
+	tmpl   *template.Template
+}
+
+// Default returns the source of the built-in template called name.
+func Default(name string) (string, error) {
+	content, err := embedded.ReadFile("templates/" + name + ".tmpl")
+	if err != nil {
+		return "", fmt.Errorf("unknown prompt template %q", name)
+	}
+	return string(content), nil
+}
+
+// Load parses the template called name from the first override that has it, or the built-in one.
+func Load(name string, overrides ...Override) (*Template, error) {
+	source, err := Default(name)
+	if err != nil {
+		return nil, err
+	}
+	origin := originEmbedded
+	for _, o := range overrides {
+		content, from, err := o(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template %s: %w", from, err)
+		}
+		source, origin = string(content), from
+		break
+	}
+	return Parse(name, origin, source)
+}
+
+// Parse parses a template source, which must define a system block.
+func Parse(name, origin, source string) (*Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		// Replaced when rendering
+		"data":    func(label, content string) string { return "" },
+		"include": func(name string, data any) (string, error) { return "", nil },
+		"join":    strings.Join,
+	}).Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template %s: %w", origin, err)
+	}
+	if tmpl.Lookup("system") == nil {
+		return nil, fmt.Errorf("invalid prompt template %s: it must define a \"system\" block with the instructions", origin)
+	}
+	return &Template{Name: name, Origin: origin, Source: source, tmpl: tmpl}, nil
+}
+
+// Render returns the system and user messages, with the untrusted data wrapped in d.
+func (t *Template) Render(d promptguard.Delimiter, data Data) (string, string, error) {
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return "", "", err
+	}
+	tmpl.Funcs(template.FuncMap{
+		"data": func(label, content string) string { return strings.TrimSuffix(d.Wrap(label, content), "\n") },
+		"include": func(name string, data any) (string, error) {
+			var b bytes.Buffer
+			err := tmpl.ExecuteTemplate(&b, name, data)
+			return b.String(), err
+		},
+	})
+
+	var system, user bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&system, "system", data); err != nil {
+		return "", "", fmt.Errorf("failed to render prompt template %s: %w", t.Origin, err)
+	}
+	if err := tmpl.Execute(&user, data); err != nil {
+		return "", "", fmt.Errorf("failed to render prompt template %s: %w", t.Origin, err)
+	}
+	return strings.TrimSpace(system.String()) + "\n", user.String(), nil
+}
+
+// canary stands in for every piece of data when validating a template.
+const canary = "NEUROSPECATION-CANARY"
+
+// Validate renders the template with sample data and checks that none of the data ends up in the system message,
+// or in the user message outside the data delimiters, where the model would take it as instructions.
+func (t *Template) Validate() error {
+	sample := Data{
+		Dir:         canary,
+		Files:       []File{{Name: canary, Content: canary}},
+		Subdirs:     []string{canary},
+		PR:          &PR{Number: 1, Title: canary, Body: canary, Author: canary, Labels: []string{canary}},
+		Diff:        canary,
+		Knowledge:   canary,
+		CodeContext: canary,
+	}
+	d := promptguard.NewDelimiter()
+	system, user, err := t.Render(d, sample)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(system) == "" {
+		return fmt.Errorf("prompt template %s has empty instructions", t.Origin)
+	}
+	if strings.Contains(system, canary) {
+		return fmt.Errorf("prompt template %s uses repository or pull request data in the system block, move it to the user message", t.Origin)
+	}
+	if strings.Contains(d.Outside(user), canary) {
+		return fmt.Errorf("prompt template %s uses repository or pull request data outside the data function", t.Origin)
+	}
+	return nil
+}
+
+// Set holds the templates of a run, by name.
+type Set map[string]*Template
+
+// LoadAll loads every template, see Load.
+func LoadAll(overrides ...Override) (Set, error) {
+	set := Set{}
+	for _, name := range Names {
+		t, err := Load(name, overrides...)
+		if err != nil {
+			return nil, err
+		}
+		set[name] = t
+	}
+	return set, nil
+}
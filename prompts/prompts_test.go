@@ -0,0 +1,101 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LarsOL/NeuroSpecation/promptguard"
+)
+
+func TestLoadAll_Defaults(t *testing.T) {
+	set, err := LoadAll()
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	for _, name := range Names {
+		tmpl := set[name]
+		if tmpl == nil || tmpl.Origin != "built-in" {
+			t.Fatalf("Expected the built-in %s template, but got %+v", name, tmpl)
+		}
+		if err := tmpl.Validate(); err != nil {
+			t.Errorf("Expected the built-in %s template to be valid, but got %v", name, err)
+		}
+	}
+}
+
+func TestTemplate_Render(t *testing.T) {
+	tmpl, err := Load(Knowledgebase)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	d := promptguard.NewDelimiter()
+	system, user, err := tmpl.Render(d, Data{Dir: "cmd", Files: []File{{Name: "main.go", Content: "package main"}}})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !strings.HasPrefix(system, "You are a seasoned staff software engineer.") {
+		t.Errorf("Expected the instructions in the system message, but got %q", system)
+	}
+	want := d.Wrap("directory information", "Directory: cmd\nNo subdirectories\nFiles:\n- main.go\npackage main\n")
+	if user != want {
+		t.Errorf("Expected the user message %q, but got %q", want, user)
+	}
+}
+
+func TestLoad_Overrides(t *testing.T) {
+	repo := t.TempDir()
+	source := "{{define \"system\"}}Review in the house style.{{end}}{{data \"diff\" .Diff}}"
+	if err := os.WriteFile(filepath.Join(repo, "review.tmpl"), []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	configured := filepath.Join(t.TempDir(), "review.tmpl")
+	if err := os.WriteFile(configured, []byte(strings.Replace(source, "house style", "configured style", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := Load(Review, FromFiles(map[string]string{Readme: configured}), FromDir(repo))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if tmpl.Origin != filepath.Join(repo, "review.tmpl") || tmpl.Source != source {
+		t.Errorf("Expected the repository template, but got %s", tmpl.Origin)
+	}
+
+	tmpl, err = Load(Review, FromFiles(map[string]string{Review: configured}), FromDir(repo))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if tmpl.Origin != configured {
+		t.Errorf("Expected the configured template to come first, but got %s", tmpl.Origin)
+	}
+
+	if _, err := Load(Review, FromFiles(map[string]string{Review: filepath.Join(repo, "missing.tmpl")})); err != nil {
+		t.Errorf("Expected a missing configured file to fall back to the built-in template, but got %v", err)
+	}
+	if _, err := Load("unknown"); err == nil {
+		t.Error("Expected an error for an unknown template, but got nil")
+	}
+}
+
+func TestTemplate_Validate(t *testing.T) {
+	testCases := map[string]string{
+		"no system block":        `{{data "diff" .Diff}}`,
+		"data in system block":   `{{define "system"}}Review {{.PR.Title}}{{end}}{{data "diff" .Diff}}`,
+		"data outside delimiter": `{{define "system"}}Review.{{end}}Title: {{.PR.Title}} {{data "diff" .Diff}}`,
+		"unknown field":          `{{define "system"}}Review.{{end}}{{data "diff" .Patch}}`,
+		"syntax error":           `{{define "system"}}Review.{{end}}{{data "diff" .Diff`,
+	}
+	for name, source := range testCases {
+		t.Run(name, func(t *testing.T) {
+			tmpl, err := Parse(Review, "test.tmpl", source)
+			if err == nil {
+				err = tmpl.Validate()
+			}
+			if err == nil {
+				t.Errorf("Expected %s to be rejected, but got nil", source)
+			}
+		})
+	}
+}
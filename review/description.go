@@ -0,0 +1,127 @@
+package review
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Markers around the AI written part of a pull request description, everything outside them is left alone.
+const (
+	SummaryStart = "<!-- neurospecation:summary:start -->"
+	SummaryEnd   = "<!-- neurospecation:summary:end -->"
+)
+
+var htmlComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+
+// descriptionSection is a part of a markdown description, started by a heading line.
+// The text before the first heading is a section without a heading.
+type descriptionSection struct {
+	heading string
+	content string
+}
+
+func splitSections(md string) []descriptionSection {
+	sections := []descriptionSection{{}}
+	inFence := false
+	for _, line := range strings.SplitAfter(normaliseNewlines(md), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+		if !inFence && strings.HasPrefix(line, "#") {
+			sections = append(sections, descriptionSection{heading: line})
+			continue
+		}
+		sections[len(sections)-1].content += line
+	}
+	return sections
+}
+
+// headingKey compares headings by their text, ignoring the heading level and case.
+func headingKey(heading string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimLeft(heading, "#")))
+}
+
+// sectionText is the meaningful text of a section, without the HTML comments templates use for instructions.
+func sectionText(content string) string {
+	return strings.TrimSpace(htmlComment.ReplaceAllString(content, ""))
+}
+
+// UnfilledSections returns the headings of the template sections that the description leaves empty or unchanged.
+func UnfilledSections(body, template string) []string {
+	if strings.TrimSpace(template) == "" {
+		return nil
+	}
+	templateText := map[string]string{}
+	for _, s := range splitSections(template) {
+		if s.heading != "" {
+			templateText[headingKey(s.heading)] = sectionText(s.content)
+		}
+	}
+
+	var unfilled []string
+	for _, s := range splitSections(body) {
+		if s.heading == "" {
+			continue
+		}
+		want, ok := templateText[headingKey(s.heading)]
+		if !ok {
+			continue
+		}
+		if text := sectionText(s.content); text == "" || text == want {
+			unfilled = append(unfilled, strings.TrimSpace(s.heading))
+		}
+	}
+	return unfilled
+}
+
+// FillSections replaces the content of the given sections of body with the content of the same sections in generated.
+// Sections that generated does not contain are left as they are.
+func FillSections(body, generated string, headings []string) string {
+	fill := map[string]bool{}
+	for _, h := range headings {
+		fill[headingKey(h)] = true
+	}
+	generatedContent := map[string]string{}
+	for _, s := range splitSections(generated) {
+		if s.heading != "" {
+			generatedContent[headingKey(s.heading)] = strings.TrimSpace(s.content)
+		}
+	}
+
+	var out strings.Builder
+	for _, s := range splitSections(body) {
+		out.WriteString(s.heading)
+		content, ok := generatedContent[headingKey(s.heading)]
+		if s.heading == "" || !fill[headingKey(s.heading)] || !ok || content == "" {
+			out.WriteString(s.content)
+			continue
+		}
+		out.WriteString(content + "\n\n")
+	}
+	return out.String()
+}
+
+// UpsertSummary puts summary between the summary markers, replacing an earlier summary or appending it to body.
+func UpsertSummary(body, summary string) string {
+	section := SummaryStart + "\n" + strings.TrimSpace(summary) + "\n" + SummaryEnd
+	before, rest, found := strings.Cut(body, SummaryStart)
+	if found {
+		if _, after, ok := strings.Cut(rest, SummaryEnd); ok {
+			return before + section + after
+		}
+	}
+	if strings.TrimSpace(body) == "" {
+		return section + "\n"
+	}
+	return strings.TrimRight(body, "\n") + "\n\n" + section + "\n"
+}
+
+// WithoutSummary returns body without the AI written summary, i.e. what the author wrote.
+func WithoutSummary(body string) string {
+	before, rest, found := strings.Cut(body, SummaryStart)
+	if !found {
+		return body
+	}
+	_, after, _ := strings.Cut(rest, SummaryEnd)
+	return before + after
+}
@@ -0,0 +1,62 @@
+package review
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testTemplate = `## Summary
+<!-- What does this change do? -->
+
+## Testing
+- [ ] Unit tests
+
+## Risks
+`
+
+func TestUnfilledSections(t *testing.T) {
+	if got := UnfilledSections(testTemplate, testTemplate); !reflect.DeepEqual(got, []string{"## Summary", "## Testing", "## Risks"}) {
+		t.Errorf("Expected all sections of an untouched template to be unfilled, but got %v", got)
+	}
+
+	body := strings.Replace(testTemplate, "<!-- What does this change do? -->", "Adds retries to the client.", 1)
+	if got := UnfilledSections(body, testTemplate); !reflect.DeepEqual(got, []string{"## Testing", "## Risks"}) {
+		t.Errorf("Expected the filled summary to be skipped, but got %v", got)
+	}
+
+	if got := UnfilledSections("Just a description", ""); got != nil {
+		t.Errorf("Expected no unfilled sections without a template, but got %v", got)
+	}
+}
+
+func TestFillSections(t *testing.T) {
+	body := strings.Replace(testTemplate, "<!-- What does this change do? -->", "Adds retries to the client.", 1)
+	generated := "## Summary\nSomething else\n\n## Testing\n- [x] Unit tests for the retry loop\n"
+
+	got := FillSections(body, generated, []string{"## Testing", "## Risks"})
+	want := "## Summary\nAdds retries to the client.\n\n## Testing\n- [x] Unit tests for the retry loop\n\n## Risks\n"
+	if got != want {
+		t.Errorf("Expected %q, but got %q", want, got)
+	}
+}
+
+func TestUpsertSummary(t *testing.T) {
+	body := UpsertSummary("Written by the author.\n", "First summary")
+	if !strings.HasPrefix(body, "Written by the author.\n\n"+SummaryStart+"\nFirst summary\n"+SummaryEnd) {
+		t.Errorf("Expected the summary to be appended, but got %q", body)
+	}
+
+	body = strings.Replace(body, "Written by the author.", "Edited by the author.", 1)
+	body = UpsertSummary(body, "Second summary")
+	if strings.Contains(body, "First summary") || !strings.Contains(body, "Second summary") || !strings.HasPrefix(body, "Edited by the author.") {
+		t.Errorf("Expected the summary to be replaced and the author's edit kept, but got %q", body)
+	}
+	if strings.Count(body, SummaryStart) != 1 {
+		t.Errorf("Expected one summary section, but got %q", body)
+	}
+
+	if got := strings.TrimSpace(WithoutSummary(body)); got != "Edited by the author." {
+		t.Errorf("Expected only the author's text, but got %q", got)
+	}
+}
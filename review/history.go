@@ -0,0 +1,40 @@
+package review
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// reviewedMarker is a hidden HTML comment in the review comment recording the last reviewed head commit.
+var reviewedMarker = regexp.MustCompile(`\n*<!-- neurospecation:reviewed-sha=([0-9a-fA-F]+) -->\n*`)
+
+// ReviewedSHA returns the head commit recorded in a review comment, or "" if the comment has no marker.
+func ReviewedSHA(comment string) string {
+	m := reviewedMarker.FindStringSubmatch(comment)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// WithReviewedSHA replaces any marker in the comment with one recording sha.
+func WithReviewedSHA(comment, sha string) string {
+	comment = reviewedMarker.ReplaceAllString(comment, "\n")
+	return strings.TrimRight(comment, "\n") + fmt.Sprintf("\n\n<!-- neurospecation:reviewed-sha=%s -->\n", sha)
+}
+
+// AppendIncremental adds the review of the commits since..head to the previous review comment,
+// keeping the earlier reviews as history.
+func AppendIncremental(previous, text, since, head string) string {
+	previous = strings.TrimRight(reviewedMarker.ReplaceAllString(previous, "\n"), "\n")
+	section := fmt.Sprintf("\n\n---\n## New since last review (%s..%s)\n\n%s", shortSHA(since), shortSHA(head), text)
+	return WithReviewedSHA(previous+section, head)
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
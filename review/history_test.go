@@ -0,0 +1,40 @@
+package review
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReviewedSHA(t *testing.T) {
+	if got := ReviewedSHA("# Review\nno marker"); got != "" {
+		t.Errorf("Expected no SHA, but got %q", got)
+	}
+
+	comment := WithReviewedSHA("# Review\nLooks good\n", "abc123")
+	if got := ReviewedSHA(comment); got != "abc123" {
+		t.Errorf("Expected abc123, but got %q", got)
+	}
+
+	comment = WithReviewedSHA(comment, "def456")
+	if got := ReviewedSHA(comment); got != "def456" {
+		t.Errorf("Expected def456, but got %q", got)
+	}
+	if strings.Count(comment, "neurospecation:reviewed-sha") != 1 {
+		t.Errorf("Expected exactly one marker, but got %q", comment)
+	}
+}
+
+func TestAppendIncremental(t *testing.T) {
+	previous := WithReviewedSHA("# Review\nFirst pass", "1111111111")
+	got := AppendIncremental(previous, "Second pass", "1111111111", "2222222222")
+
+	if !strings.HasPrefix(got, "# Review\nFirst pass\n\n---\n## New since last review (1111111..2222222)\n\nSecond pass") {
+		t.Errorf("Expected the new review to be appended after the previous one, but got %q", got)
+	}
+	if sha := ReviewedSHA(got); sha != "2222222222" {
+		t.Errorf("Expected the marker to record the new head, but got %q", sha)
+	}
+	if strings.Count(got, "neurospecation:reviewed-sha") != 1 {
+		t.Errorf("Expected exactly one marker, but got %q", got)
+	}
+}
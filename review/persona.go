@@ -0,0 +1,133 @@
+package review
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Persona is a specialised reviewer, run as its own pass over the pull request.
+type Persona struct {
+	Name string `mapstructure:"name"`
+	// Focus tells the pass what to review, everything else is left to the other passes
+	Focus string `mapstructure:"focus"`
+	// Model, if set, is used for this pass instead of the default model
+	Model string `mapstructure:"model"`
+}
+
+// Personas are the built-in reviewers, by name.
+var Personas = map[string]Persona{
+	"security": {
+		Name:  "security",
+		Focus: "Security: injection, authentication and authorisation, handling of untrusted input, secrets, cryptography, unsafe defaults and risky dependencies.",
+	},
+	"performance": {
+		Name:  "performance",
+		Focus: "Performance: algorithmic complexity, unnecessary allocations and copies, repeated queries or requests, blocking work on hot paths and missing caching or batching.",
+	},
+	"concurrency": {
+		Name:  "concurrency",
+		Focus: "Concurrency: data races, deadlocks, goroutine and resource leaks, missing synchronisation, ordering assumptions and context cancellation.",
+	},
+	"api": {
+		Name:  "api",
+		Focus: "API compatibility: breaking changes to exported identifiers, function signatures, wire and file formats, configuration, command line flags and defaults, and missing deprecation paths.",
+	},
+	"tests": {
+		Name:  "tests",
+		Focus: "Tests: missing or weak tests for the changed behaviour, untested error paths and edge cases, and brittle or flaky tests.",
+	},
+}
+
+// ResolvePersonas looks up the named personas. custom adds personas or changes the focus or model of built-in ones,
+// fields it leaves empty keep their built-in value.
+func ResolvePersonas(names []string, custom map[string]Persona) ([]Persona, error) {
+	var personas []Persona
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if slices.ContainsFunc(personas, func(p Persona) bool { return p.Name == name }) {
+			continue
+		}
+		p, ok := Personas[name]
+		if c, found := custom[name]; found {
+			ok = true
+			p.Name = name
+			if c.Focus != "" {
+				p.Focus = c.Focus
+			}
+			if c.Model != "" {
+				p.Model = c.Model
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown reviewer %q, expected one of %v or a persona defined in the config", name, slices.Sorted(maps.Keys(Personas)))
+		}
+		if p.Focus == "" {
+			return nil, fmt.Errorf("reviewer %s has no focus", name)
+		}
+		personas = append(personas, p)
+	}
+	return personas, nil
+}
+
+// Instructions narrow a review down to the persona's focus.
+func (p Persona) Instructions() string {
+	return "This is the " + p.Name + " pass of a review split between several specialised reviewers. Only review the change for " + p.Focus + " Leave every other aspect to the other reviewers, and only report findings within your focus.\n"
+}
+
+// Merge combines the findings of several reviewers. Findings about the same issue, in the same file on overlapping
+// lines with the same rule id or title, are folded into one that keeps the highest severity and lists every persona
+// that raised it.
+func Merge(findings []Finding) []Finding {
+	var merged []Finding
+	for _, f := range findings {
+		i := slices.IndexFunc(merged, func(m Finding) bool { return sameIssue(m, f) })
+		if i == -1 {
+			merged = append(merged, f)
+			continue
+		}
+		merged[i] = fold(merged[i], f)
+	}
+	return merged
+}
+
+func sameIssue(a, b Finding) bool {
+	if a.File != b.File {
+		return false
+	}
+	switch {
+	case a.StartLine <= 0 && b.StartLine <= 0:
+	case a.StartLine <= 0 || b.StartLine <= 0:
+		return false
+	case a.StartLine > b.EndLine || b.StartLine > a.EndLine:
+		return false
+	}
+	return (a.RuleID != "" && strings.EqualFold(a.RuleID, b.RuleID)) || normaliseTitle(a.Title) == normaliseTitle(b.Title)
+}
+
+func normaliseTitle(title string) string {
+	return strings.Join(strings.Fields(strings.ToLower(strings.TrimRight(title, ".!"))), " ")
+}
+
+// fold keeps the more severe of two findings about the same issue, with the personas of both.
+func fold(a, b Finding) Finding {
+	keep, other := a, b
+	if b.Severity.Rank() > a.Severity.Rank() {
+		keep, other = b, a
+	}
+	if keep.Suggestion == "" && other.Suggestion != "" && keep.StartLine == other.StartLine && keep.EndLine == other.EndLine {
+		keep.Original, keep.Suggestion = other.Original, other.Suggestion
+	}
+	if keep.Guideline == "" {
+		keep.Guideline = other.Guideline
+	}
+	personas := slices.Clone(a.Personas)
+	for _, p := range b.Personas {
+		if !slices.Contains(personas, p) {
+			personas = append(personas, p)
+		}
+	}
+	keep.Personas = personas
+	return keep
+}
@@ -0,0 +1,59 @@
+package review
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolvePersonas(t *testing.T) {
+	custom := map[string]Persona{
+		"security": {Model: "o3"},
+		"i18n":     {Focus: "Internationalisation: hard-coded user facing text."},
+	}
+	personas, err := ResolvePersonas([]string{"Security", "tests", "i18n", "security"}, custom)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(personas) != 3 {
+		t.Fatalf("Expected 3 personas, but got %+v", personas)
+	}
+	if p := personas[0]; p.Name != "security" || p.Model != "o3" || p.Focus != Personas["security"].Focus {
+		t.Errorf("Expected the built-in security persona with the configured model, but got %+v", p)
+	}
+	if p := personas[2]; p.Name != "i18n" || p.Model != "" {
+		t.Errorf("Expected the custom i18n persona, but got %+v", p)
+	}
+
+	if _, err := ResolvePersonas([]string{"style"}, nil); err == nil {
+		t.Error("Expected an error for an unknown persona, but got nil")
+	}
+	if _, err := ResolvePersonas([]string{"style"}, map[string]Persona{"style": {Model: "gpt-4o"}}); err == nil {
+		t.Error("Expected an error for a custom persona without a focus, but got nil")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	findings := []Finding{
+		{Severity: SeverityMedium, RuleID: "sql-injection", File: "db.go", StartLine: 10, EndLine: 12, Title: "Query built from input", Personas: []string{"security"}},
+		{Severity: SeverityLow, RuleID: "missing-tests", File: "db.go", StartLine: 10, EndLine: 10, Title: "Untested query", Personas: []string{"tests"}},
+		{Severity: SeverityHigh, RuleID: "sql-injection", File: "db.go", StartLine: 12, EndLine: 14, Title: "SQL injection", Personas: []string{"api"},
+			Original: "q := x", Suggestion: "q := y"},
+		{Severity: SeverityInfo, File: "db.go", Title: "Consider a query builder.", Personas: []string{"performance"}},
+		{Severity: SeverityLow, File: "db.go", Title: "consider a  query builder", Personas: []string{"security"}},
+		{Severity: SeverityLow, RuleID: "sql-injection", File: "db.go", StartLine: 40, EndLine: 40, Title: "Another query", Personas: []string{"security"}},
+	}
+	merged := Merge(findings)
+	if len(merged) != 4 {
+		t.Fatalf("Expected 4 findings, but got %d: %+v", len(merged), merged)
+	}
+	if f := merged[0]; f.Severity != SeverityHigh || f.Title != "SQL injection" || !slices.Equal(f.Personas, []string{"security", "api"}) {
+		t.Errorf("Expected the overlapping sql-injection findings to be folded into the high one, but got %+v", f)
+	}
+	if f := merged[2]; f.Severity != SeverityLow || !slices.Equal(f.Personas, []string{"performance", "security"}) {
+		t.Errorf("Expected the findings with the same title to be folded, but got %+v", f)
+	}
+	if !strings.Contains(merged[0].Details(), "Raised by: security, api") {
+		t.Errorf("Expected the details to name the personas, but got %q", merged[0].Details())
+	}
+}
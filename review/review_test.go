@@ -0,0 +1,130 @@
+package review
+
+import (
+	"testing"
+)
+
+func TestParseFindings(t *testing.T) {
+	output := "## High-Level Architectural Concerns\nLooks fine.\n\n```json\n" +
+		`[
+			{"severity": "HIGH", "file": "cmd/pr.go", "start_line": 10, "end_line": 12, "title": "Unchecked error", "message": "Handle it"},
+			{"severity": "bogus", "file": "main.go", "start_line": 5, "title": "Odd", "message": "Hmm", "guideline": "cmd-dry-run"}
+		]` + "\n```\n"
+
+	text, findings, err := ParseFindings(output)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if text != "## High-Level Architectural Concerns\nLooks fine." {
+		t.Errorf("Expected the json block to be removed from the text, but got %q", text)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 findings, but got %d", len(findings))
+	}
+	if findings[0].Severity != SeverityHigh || findings[0].File != "cmd/pr.go" || findings[0].EndLine != 12 {
+		t.Errorf("Unexpected first finding: %+v", findings[0])
+	}
+	if findings[1].Severity != SeverityMedium {
+		t.Errorf("Expected unknown severities to become medium, but got %s", findings[1].Severity)
+	}
+	if findings[1].Guideline != "cmd-dry-run" {
+		t.Errorf("Expected the cited guideline, but got %q", findings[1].Guideline)
+	}
+	if findings[1].EndLine != 5 {
+		t.Errorf("Expected a missing end line to default to the start line, but got %d", findings[1].EndLine)
+	}
+}
+
+func TestParseFindings_FenceInSuggestion(t *testing.T) {
+	output := "Looks fine.\n\n```json\n" +
+		`[{"severity": "low", "file": "README.md", "start_line": 3, "title": "Fence", "message": "Close the block",` +
+		` "original": "go run .", "suggestion": "` + "```" + `sh\ngo run .\n` + "```" + `"}]` + "\n```\n"
+
+	text, findings, err := ParseFindings(output)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if len(findings) != 1 || findings[0].Suggestion != "```sh\ngo run .\n```" {
+		t.Fatalf("Expected the suggestion to keep its code fences, but got %+v", findings)
+	}
+	if text != "Looks fine." {
+		t.Errorf("Expected the json block to be removed from the text, but got %q", text)
+	}
+}
+
+func TestParseFindings_Invalid(t *testing.T) {
+	for name, output := range map[string]string{
+		"no block":       "just text",
+		"unterminated":   "text\n```json\n[]",
+		"invalid json":   "text\n```json\n{not json}\n```",
+		"not json array": "text\n```json\n{\"severity\": \"high\"}\n```",
+		"trailing data":  "text\n```json\n[] []\n```",
+	} {
+		t.Run(name, func(t *testing.T) {
+			text, findings, err := ParseFindings(output)
+			if err == nil {
+				t.Error("Expected an error, but got nil")
+			}
+			if text != output || findings != nil {
+				t.Errorf("Expected the output to be returned unchanged, but got %q, %v", text, findings)
+			}
+		})
+	}
+}
+
+func TestMaxSeverity(t *testing.T) {
+	if got := MaxSeverity(nil); got != "" {
+		t.Errorf("Expected no severity for no findings, but got %q", got)
+	}
+	findings := []Finding{{Severity: SeverityLow}, {Severity: SeverityCritical}, {Severity: SeverityMedium}}
+	if got := MaxSeverity(findings); got != SeverityCritical {
+		t.Errorf("Expected critical, but got %q", got)
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	if sev, err := ParseSeverity(" Medium "); err != nil || sev != SeverityMedium {
+		t.Errorf("Expected medium, but got %q, %v", sev, err)
+	}
+	if _, err := ParseSeverity("urgent"); err == nil {
+		t.Error("Expected an error for an unknown severity, but got nil")
+	}
+}
+
+func TestCountAtOrAbove(t *testing.T) {
+	findings := []Finding{{Severity: SeverityLow}, {Severity: SeverityHigh}, {Severity: SeverityCritical}, {Severity: SeverityMedium}}
+	testCases := []struct {
+		threshold Severity
+		expected  int
+	}{
+		{SeverityCritical, 1},
+		{SeverityHigh, 2},
+		{SeverityMedium, 3},
+		{SeverityInfo, 4},
+	}
+	for _, tc := range testCases {
+		if got := CountAtOrAbove(findings, tc.threshold); got != tc.expected {
+			t.Errorf("CountAtOrAbove(%s) = %d, want %d", tc.threshold, got, tc.expected)
+		}
+	}
+}
+
+func TestSummaryTable(t *testing.T) {
+	if got := SummaryTable(nil); got != "**Findings:** none\n" {
+		t.Errorf("Unexpected table for no findings: %q", got)
+	}
+
+	findings := []Finding{
+		{Severity: SeverityLow, File: "a.go", StartLine: 3, EndLine: 3, Title: "Naming", Guideline: "CONTRIBUTING.md"},
+		{Severity: SeverityCritical, File: "b.go", StartLine: 1, EndLine: 4, Title: "Secret | leaked"},
+		{Severity: SeverityLow, Title: "General"},
+	}
+	expected := "**Findings:** 1 critical, 2 low\n\n" +
+		"| Severity | Location | Finding |\n|---|---|---|\n" +
+		"| critical | b.go:1-4 | Secret \\| leaked |\n" +
+		"| low | a.go:3 | Naming (CONTRIBUTING.md) |\n" +
+		"| low |  | General |\n"
+	if got := SummaryTable(findings); got != expected {
+		t.Errorf("Unexpected table:\n%s\nwant:\n%s", got, expected)
+	}
+}
@@ -0,0 +1,174 @@
+package review
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	// defaultRuleID is used for findings the model did not categorise
+	defaultRuleID = "ai-review"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string            `json:"id"`
+	ShortDescription     sarifMessage      `json:"shortDescription"`
+	DefaultConfiguration sarifRuleConfig   `json:"defaultConfiguration"`
+	Properties           map[string]string `json:"properties,omitempty"`
+}
+
+type sarifRuleConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine,omitempty"`
+}
+
+// sarifLevel maps severities to SARIF result levels.
+func sarifLevel(sev Severity) string {
+	switch sev {
+	case SeverityCritical, SeverityHigh:
+		return "error"
+	case SeverityMedium:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// securitySeverity is the CVSS-like score GitHub code scanning uses to rank results.
+func securitySeverity(sev Severity) string {
+	switch sev {
+	case SeverityCritical:
+		return "9.5"
+	case SeverityHigh:
+		return "8.0"
+	case SeverityMedium:
+		return "5.5"
+	case SeverityLow:
+		return "3.0"
+	default:
+		return "0.0"
+	}
+}
+
+// ToSARIF converts findings into a SARIF 2.1.0 log, with one rule per distinct rule ID.
+func ToSARIF(findings []Finding, toolVersion string) ([]byte, error) {
+	rules := map[string]sarifRule{}
+	results := []sarifResult{}
+	for _, f := range findings {
+		ruleID := f.RuleID
+		if ruleID == "" {
+			ruleID = defaultRuleID
+		}
+		// A rule takes the severity of its most severe finding
+		if r, ok := rules[ruleID]; !ok || Severity(r.Properties["severity"]).Rank() < f.Severity.Rank() {
+			rules[ruleID] = sarifRule{
+				ID:                   ruleID,
+				ShortDescription:     sarifMessage{Text: f.Title},
+				DefaultConfiguration: sarifRuleConfig{Level: sarifLevel(f.Severity)},
+				Properties: map[string]string{
+					"severity":          string(f.Severity),
+					"security-severity": securitySeverity(f.Severity),
+				},
+			}
+		}
+
+		message := f.Details()
+		if f.Title != "" {
+			message = f.Title + ": " + message
+		}
+		result := sarifResult{
+			RuleID:     ruleID,
+			Level:      sarifLevel(f.Severity),
+			Message:    sarifMessage{Text: message},
+			Properties: map[string]string{"severity": string(f.Severity)},
+		}
+		if f.Guideline != "" {
+			result.Properties["guideline"] = f.Guideline
+		}
+		if len(f.Personas) > 0 {
+			result.Properties["personas"] = strings.Join(f.Personas, ",")
+		}
+		if f.File != "" {
+			loc := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: f.File, URIBaseID: "%SRCROOT%"},
+			}}
+			if f.StartLine > 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{StartLine: f.StartLine, EndLine: f.EndLine}
+			}
+			result.Locations = []sarifLocation{loc}
+		}
+		results = append(results, result)
+	}
+
+	driver := sarifDriver{
+		Name:           "NeuroSpecation",
+		Version:        toolVersion,
+		InformationURI: "https://github.com/LarsOL/NeuroSpecation",
+		Rules:          []sarifRule{},
+	}
+	for _, r := range rules {
+		driver.Rules = append(driver.Rules, r)
+	}
+	sort.Slice(driver.Rules, func(i, j int) bool { return driver.Rules[i].ID < driver.Rules[j].ID })
+
+	return json.MarshalIndent(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}, "", "  ")
+}
@@ -0,0 +1,71 @@
+package review
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToSARIF(t *testing.T) {
+	findings := []Finding{
+		{Severity: SeverityCritical, RuleID: "sql-injection", File: "db/query.go", StartLine: 10, EndLine: 12, Title: "SQL injection", Message: "Use parameters"},
+		{Severity: SeverityLow, RuleID: "sql-injection", File: "db/other.go", StartLine: 3, EndLine: 3, Title: "Minor", Message: "Also here"},
+		{Severity: SeverityMedium, File: "README.md", Title: "Docs", Message: "Document the flag"},
+	}
+
+	out, err := ToSARIF(findings, "v1.2.3")
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(out, &log); err != nil {
+		t.Fatalf("Expected valid JSON, but got: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("Unexpected SARIF log: %+v", log)
+	}
+	run := log.Runs[0]
+	if run.Tool.Driver.Name != "NeuroSpecation" || run.Tool.Driver.Version != "v1.2.3" {
+		t.Errorf("Unexpected driver: %+v", run.Tool.Driver)
+	}
+
+	if len(run.Tool.Driver.Rules) != 2 || run.Tool.Driver.Rules[0].ID != defaultRuleID || run.Tool.Driver.Rules[1].ID != "sql-injection" {
+		t.Fatalf("Expected sorted rules [ai-review sql-injection], but got %+v", run.Tool.Driver.Rules)
+	}
+	if level := run.Tool.Driver.Rules[1].DefaultConfiguration.Level; level != "error" {
+		t.Errorf("Expected a rule to take its most severe level, but got %s", level)
+	}
+
+	if len(run.Results) != 3 {
+		t.Fatalf("Expected 3 results, but got %d", len(run.Results))
+	}
+	first := run.Results[0]
+	if first.RuleID != "sql-injection" || first.Level != "error" || first.Message.Text != "SQL injection: Use parameters" {
+		t.Errorf("Unexpected first result: %+v", first)
+	}
+	region := first.Locations[0].PhysicalLocation.Region
+	if first.Locations[0].PhysicalLocation.ArtifactLocation.URI != "db/query.go" || region.StartLine != 10 || region.EndLine != 12 {
+		t.Errorf("Unexpected location: %+v", first.Locations[0])
+	}
+	if run.Results[2].Locations[0].PhysicalLocation.Region != nil {
+		t.Error("Expected no region for findings without lines")
+	}
+	if run.Results[2].RuleID != defaultRuleID || run.Results[2].Level != "warning" {
+		t.Errorf("Unexpected result for uncategorised finding: %+v", run.Results[2])
+	}
+}
+
+func TestToSARIF_NoFindings(t *testing.T) {
+	out, err := ToSARIF(nil, "dev")
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	var log map[string]any
+	if err := json.Unmarshal(out, &log); err != nil {
+		t.Fatalf("Expected valid JSON, but got: %v", err)
+	}
+	results := log["runs"].([]any)[0].(map[string]any)["results"].([]any)
+	if len(results) != 0 {
+		t.Errorf("Expected an empty results array, but got %v", results)
+	}
+}
@@ -0,0 +1,125 @@
+package review
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/LarsOL/NeuroSpecation/pathpolicy"
+)
+
+// DiffLines records, per file, which lines of the new version appear in a unified diff.
+// Review comments can only be anchored to these lines.
+type DiffLines map[string]map[int]bool
+
+// ParseDiffLines collects the added and context lines on the new side of a git diff. The "---" and "+++" file headers
+// are only recognised before a file's first hunk, inside a hunk they are removed or added lines. Paths git quotes,
+// such as non-ASCII ones, are unquoted.
+func ParseDiffLines(diff string) DiffLines {
+	lines := DiffLines{}
+	var file string
+	newLine := 0
+	inHunk := false
+	for _, l := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(l, "diff --git"):
+			file, newLine, inHunk = "", 0, false
+		case !inHunk && strings.HasPrefix(l, "+++ "):
+			// Files whose path cannot be read get no lines, so no comment is anchored to them
+			file, _ = pathpolicy.NewFilePath(l)
+		case !inHunk && strings.HasPrefix(l, "--- "):
+		case strings.HasPrefix(l, "@@"):
+			newLine = HunkStart(l)
+			inHunk = true
+		case newLine == 0 || file == "":
+			continue
+		case strings.HasPrefix(l, "+"), strings.HasPrefix(l, " "):
+			if lines[file] == nil {
+				lines[file] = map[int]bool{}
+			}
+			lines[file][newLine] = true
+			newLine++
+		}
+	}
+	return lines
+}
+
+// HunkStart returns the first new-side line of a "@@ -a,b +c,d @@" hunk header, or 0 if it is malformed.
+func HunkStart(header string) int {
+	_, after, ok := strings.Cut(header, " +")
+	if !ok {
+		return 0
+	}
+	start, _, _ := strings.Cut(after, " ")
+	start, _, _ = strings.Cut(start, ",")
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// ValidateSuggestion checks that the finding's suggestion applies cleanly to content, the file at the head revision:
+// the line range must exist, be part of the diff, and currently read exactly as the finding's Original text.
+func ValidateSuggestion(f Finding, content string, diffLines DiffLines) error {
+	if f.Suggestion == "" {
+		return fmt.Errorf("finding has no suggestion")
+	}
+	if f.File == "" || f.StartLine <= 0 || f.EndLine < f.StartLine {
+		return fmt.Errorf("suggestion has no valid line range")
+	}
+
+	fileLines := strings.Split(normaliseNewlines(content), "\n")
+	if f.EndLine > len(fileLines) {
+		return fmt.Errorf("suggestion range %s is beyond the end of the file (%d lines)", f.Location(), len(fileLines))
+	}
+	for line := f.StartLine; line <= f.EndLine; line++ {
+		if !diffLines[f.File][line] {
+			return fmt.Errorf("line %d of %s is not part of the diff", line, f.File)
+		}
+	}
+
+	current := strings.Join(fileLines[f.StartLine-1:f.EndLine], "\n")
+	if trimLines(current) != trimLines(f.Original) {
+		return fmt.Errorf("suggestion for %s does not match the current text at the head revision", f.Location())
+	}
+	if trimLines(current) == trimLines(f.Suggestion) {
+		return fmt.Errorf("suggestion for %s does not change anything", f.Location())
+	}
+	return nil
+}
+
+// SuggestionComment renders the finding as an inline comment with a GitHub suggested-change block.
+func SuggestionComment(f Finding) string {
+	suggestion := strings.TrimSuffix(normaliseNewlines(f.Suggestion), "\n")
+	fence := suggestionFence(suggestion)
+	return fmt.Sprintf("**[%s] %s**\n\n%s\n\n%ssuggestion\n%s\n%s\n", f.Severity, f.Title, f.Details(), fence, suggestion, fence)
+}
+
+// suggestionFence returns a backtick fence longer than any backtick run in the suggestion, so that code containing a
+// fence of its own does not close the suggestion block early.
+func suggestionFence(suggestion string) string {
+	longest, run := 0, 0
+	for _, r := range suggestion {
+		if r != '`' {
+			run = 0
+			continue
+		}
+		run++
+		longest = max(longest, run)
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+func normaliseNewlines(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+// trimLines ignores trailing whitespace and trailing empty lines, which models do not reproduce reliably.
+func trimLines(s string) string {
+	lines := strings.Split(normaliseNewlines(s), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
@@ -0,0 +1,119 @@
+package review
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,5 +1,7 @@
+ package main
+ 
+-import "fmt"
++import (
++	"fmt"
++)
+ 
+ func main() {
+@@ -11,2 +12,3 @@ func helper() {
+ 	x := 1
++	y := 2
+ }
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,1 +0,0 @@
+-package old
+`
+
+func TestParseDiffLines(t *testing.T) {
+	lines := ParseDiffLines(testDiff)
+	for _, l := range []int{1, 2, 3, 4, 5, 6, 7, 12, 13, 14} {
+		if !lines["main.go"][l] {
+			t.Errorf("Expected line %d of main.go to be in the diff", l)
+		}
+	}
+	for _, l := range []int{8, 11, 15} {
+		if lines["main.go"][l] {
+			t.Errorf("Expected line %d of main.go not to be in the diff", l)
+		}
+	}
+	if _, ok := lines["old.go"]; ok {
+		t.Error("Expected deleted files to have no new lines")
+	}
+}
+
+func TestParseDiffLinesHeaderLikeContent(t *testing.T) {
+	// A removed "-- comment" line and an added "++ counter" line look like file headers
+	diff := "diff --git a/query.sql b/query.sql\n--- a/query.sql\n+++ b/query.sql\n@@ -1,3 +1,3 @@\n" +
+		" SELECT 1;\n--- old comment\n+++ new comment\n SELECT 2;\n"
+	lines := ParseDiffLines(diff)
+	for _, l := range []int{1, 2, 3} {
+		if !lines["query.sql"][l] {
+			t.Errorf("Expected line %d of query.sql to be in the diff, but got %v", l, lines)
+		}
+	}
+	if len(lines) != 1 {
+		t.Errorf("Expected only query.sql in the diff, but got %v", lines)
+	}
+}
+
+func TestValidateSuggestion(t *testing.T) {
+	head := "package main\n\nimport (\n\t\"fmt\"\n)\n\nfunc main() {\n}\n\n\nfunc helper() {\n\tx := 1\n\ty := 2\n}\n"
+	diffLines := ParseDiffLines(testDiff)
+	valid := Finding{File: "main.go", StartLine: 12, EndLine: 13, Original: "\tx := 1\n\ty := 2  \n", Suggestion: "\tx, y := 1, 2"}
+
+	if err := ValidateSuggestion(valid, head, diffLines); err != nil {
+		t.Errorf("Expected a valid suggestion, but got: %v", err)
+	}
+
+	testCases := map[string]func(f *Finding){
+		"no suggestion":      func(f *Finding) { f.Suggestion = "" },
+		"no range":           func(f *Finding) { f.StartLine = 0 },
+		"beyond end":         func(f *Finding) { f.StartLine, f.EndLine = 40, 41 },
+		"outside diff":       func(f *Finding) { f.StartLine, f.EndLine, f.Original = 10, 10, "" },
+		"stale original":     func(f *Finding) { f.Original = "\tx := 3\n\ty := 2" },
+		"unchanged":          func(f *Finding) { f.Suggestion = f.Original },
+		"other file":         func(f *Finding) { f.File = "other.go" },
+		"inverted range end": func(f *Finding) { f.EndLine = 11 },
+	}
+	for name, mutate := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f := valid
+			mutate(&f)
+			if err := ValidateSuggestion(f, head, diffLines); err == nil {
+				t.Error("Expected an error, but got nil")
+			}
+		})
+	}
+}
+
+func TestSuggestionComment(t *testing.T) {
+	f := Finding{Severity: SeverityLow, Title: "Simplify", Message: "Combine the declarations", Suggestion: "\tx, y := 1, 2\r\n"}
+	got := SuggestionComment(f)
+	if !strings.Contains(got, "```suggestion\n\tx, y := 1, 2\n```") {
+		t.Errorf("Expected a suggestion block, but got %q", got)
+	}
+	if !strings.HasPrefix(got, "**[low] Simplify**") {
+		t.Errorf("Expected the comment to start with the severity and title, but got %q", got)
+	}
+
+	f.Suggestion = "// Example:\n// ```go\n// x := 1\n// ```"
+	got = SuggestionComment(f)
+	if !strings.Contains(got, "````suggestion\n"+f.Suggestion+"\n````\n") {
+		t.Errorf("Expected a fence longer than the one in the suggestion, but got %q", got)
+	}
+}
+
+func TestParseDiffLinesQuotedPath(t *testing.T) {
+	diff := `diff --git "a/na\303\257ve.go" "b/na\303\257ve.go"` + "\n" + `--- "a/na\303\257ve.go"` + "\n" +
+		`+++ "b/na\303\257ve.go"` + "\n@@ -1,1 +1,2 @@\n package main\n+// naïve\n"
+	lines := ParseDiffLines(diff)
+	if !lines["naïve.go"][1] || !lines["naïve.go"][2] {
+		t.Errorf("Expected lines 1 and 2 of naïve.go to be in the diff, but got %v", lines)
+	}
+}
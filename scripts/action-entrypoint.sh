@@ -0,0 +1,34 @@
+#!/bin/sh
+# Entrypoint of the GitHub Action: neurospecation [debug] [command] [flags].
+# A flag is only passed when its input is set, so that the same setting in .neurospecation.yaml applies otherwise,
+# and only to the pr command, which is the only one that has them.
+set -e
+
+debug="$1"
+command="$2"
+set --
+if [ -n "$debug" ]; then
+  set -- "$debug"
+fi
+if [ -n "$command" ]; then
+  set -- "$@" "$command"
+fi
+
+if [ "$command" = "pr" ]; then
+  for flag in \
+    "model=$NS_MODEL" \
+    "small-model=$NS_SMALL_MODEL" \
+    "publish=$NS_PUBLISH" \
+    "fail-on=$NS_FAIL_ON" \
+    "full-review=$NS_FULL_REVIEW" \
+    "reviewers=$NS_REVIEWERS" \
+    "triage=$NS_TRIAGE" \
+    "max-cost=$NS_MAX_COST" \
+    "max-tokens=$NS_MAX_TOKENS"; do
+    if [ -n "${flag#*=}" ]; then
+      set -- "$@" "--$flag"
+    fi
+  done
+fi
+
+exec /neurospecation "$@"